@@ -4,21 +4,109 @@ package cache
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
+// Version is the version of the structured cache file format written by Sync.
+const Version = 1
+
+// BackupSuffix is appended to the path of a cache file to name the copy of
+// the cache file as it was before it was last written.
+const BackupSuffix = ".bak"
+
+// Cache is the list of repositories available on a server, along with any
+// metadata known about each of them.
 type Cache struct {
-	FilePath string
-	List     []string
+	FilePath  string
+	List      []string
+	Meta      map[string]Repo  // metadata of repositories in List, keyed by name
+	Groups    map[string]Group // named groups of repositories
+	Dialect   Dialect          // default syntax of patterns given to Match
+	MaxAge    time.Duration    // refresh the cache in Sync when older than this
+	Refreshed time.Time        // time of the last refresh, if recorded
+	Diff      *Diff            // changes made by the last refresh in Sync, if any
+}
+
+// Diff is the set of repositories added and removed by a cache refresh.
+type Diff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// diff returns the repositories in next but not prev, and those in prev but
+// not next.
+func diff(prev, next []string) *Diff {
+	d := &Diff{Added: []string{}, Removed: []string{}}
+	in := func(list []string) map[string]bool {
+		m := make(map[string]bool, len(list))
+		for _, repo := range list {
+			m[repo] = true
+		}
+		return m
+	}
+	inPrev, inNext := in(prev), in(next)
+	for _, repo := range next {
+		if !inPrev[repo] {
+			d.Added = append(d.Added, repo)
+		}
+	}
+	for _, repo := range prev {
+		if !inNext[repo] {
+			d.Removed = append(d.Removed, repo)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	return d
+}
+
+// Repo describes a single repository.
+//
+// Name is the path of the repository relative to the server root, which for
+// repositories nested in subdirectories has more than one "/"-separated
+// component, e.g., "teams/avionics/fcs".
+//
+// Only Name is required. The remaining fields are optional metadata that are
+// retained across cache updates for as long as the repository exists.
+type Repo struct {
+	Name        string    `json:"name"`
+	Revision    int64     `json:"revision,omitempty"` // youngest revision
+	Changed     time.Time `json:"changed,omitzero"`   // date of youngest revision
+	UUID        string    `json:"uuid,omitempty"`
+	Size        int64     `json:"size,omitempty"` // in bytes
+	Description string    `json:"description,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+}
+
+// Group is a named selection of repositories, which may be referenced in
+// patterns given to Match with GroupPrefix.
+//
+// The members of a group are the union of the repositories listed in Repos,
+// the repositories selected by Match and Ignore, and the members of each group
+// named in Groups. A group with a single repository serves as an alias.
+type Group struct {
+	Repos  []string `json:"repos,omitempty"`  // names of member repositories
+	Match  []string `json:"match,omitempty"`  // select patterns
+	Ignore []string `json:"ignore,omitempty"` // ignore patterns
+	Groups []string `json:"groups,omitempty"` // names of member groups
+}
+
+// document is the structured cache file format.
+type document struct {
+	Version   int              `json:"version"`
+	Refreshed time.Time        `json:"refreshed,omitzero"`
+	Repos     []Repo           `json:"repos"`
+	Groups    map[string]Group `json:"groups,omitempty"`
 }
 
 func findFile(name string, defaultPath string) (path string) {
@@ -58,61 +146,292 @@ func New(name string) *Cache {
 	return &Cache{
 		FilePath: findFile(name, "."),
 		List:     []string{},
+		Meta:     map[string]Repo{},
+		Groups:   map[string]Group{},
 	}
 }
 
-func (c *Cache) Sync(filePath string, update bool, sshCmd string) error {
+// Sync loads the cache from filePath, first refreshing it with the
+// repositories listed by src if update is true.
+//
+// If c.MaxAge is positive, the cache is also refreshed if it is missing or was
+// last refreshed longer than c.MaxAge ago (see lastRefresh). If refreshing a
+// stale cache fails, a warning is logged and the stale cache is used.
+func (c *Cache) Sync(filePath string, update bool, src Source) error {
 
 	c.FilePath = filePath
-	c.List = []string{} // clear existing list
+	c.Diff = nil
 
-	if update {
-		sshCmd = strings.TrimSpace(sshCmd)
-		if sshCmd == "" {
-			return fmt.Errorf("undefined SSH command: set RESVN_SSH or use -S")
+	stale := false
+	if !update && c.MaxAge > 0 {
+		refreshed, err := lastRefresh(c.FilePath)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			log.Printf("refreshing missing cache %s\n", c.FilePath)
+			update = true
+		case err == nil && time.Since(refreshed) > c.MaxAge:
+			log.Printf("refreshing stale cache %s (older than %s)\n", c.FilePath, c.MaxAge)
+			stale = true
 		}
-		// write all repos to a new temporary file
-		tmp, err := c.update(sshCmd)
-		if nil != err {
-			return err
+	}
+
+	// hold the lock until the cache is loaded, so that it cannot be replaced
+	// by another process in the meantime.
+	release, err := lockFile(c.FilePath, update || stale)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if stale {
+		if err := c.refresh(src); err != nil {
+			log.Printf("warning: using stale cache: %v\n", err)
 		}
-		// ensure our target repo file path exists
-		if err := os.MkdirAll(filepath.Dir(c.FilePath), fs.ModePerm); nil != err {
+	}
+
+	if update {
+		if err := c.refresh(src); err != nil {
 			return err
 		}
-		// move the temporary file in place of our given definitions file
-		os.Rename(tmp.Name(), c.FilePath)
 	}
 
-	file, err := os.Open(c.FilePath)
+	return c.load()
+}
+
+// lastRefresh returns the time the cache file at path was last refreshed.
+//
+// The time is recorded in the structured format, so that rewriting the cache
+// file without refreshing it (e.g., saving a group) does not reset its age.
+// For a legacy plain-text cache, the modification time of the file is used.
+func lastRefresh(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if isDocument(data) {
+		var doc document
+		if err := json.Unmarshal(data, &doc); err == nil && !doc.Refreshed.IsZero() {
+			return doc.Refreshed, nil
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// refresh replaces the cache file with the repositories listed by src. The
+// caller must hold an exclusive lock on the cache file.
+func (c *Cache) refresh(src Source) error {
+	if src == nil {
+		return fmt.Errorf("undefined SSH command: set RESVN_SSH or use -S")
+	}
+	repos, err := c.update(src)
 	if nil != err {
 		return err
 	}
-	defer file.Close()
+	c.Refreshed = time.Now()
+	return c.save(repos)
+}
 
-	scan := bufio.NewScanner(file)
+// save replaces the cache file with the given repositories and all groups,
+// keeping the previous cache file as a backup. The caller must hold an
+// exclusive lock on the cache file.
+func (c *Cache) save(repos []string) error {
+	var buf bytes.Buffer
+	if err := c.write(&buf, repos); nil != err {
+		return err
+	}
+	prev, err := os.ReadFile(c.FilePath)
+	switch {
+	case err == nil:
+		if err := writeFile(c.FilePath+BackupSuffix, prev); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	return writeFile(c.FilePath, buf.Bytes())
+}
 
-	for scan.Scan() {
-		c.List = append(c.List, scan.Text())
+// writeFile atomically replaces the file at path with data.
+//
+// The data is first written to a temporary file in the same directory, which
+// is then renamed in place of path. In case of an error, an existing file at
+// path is left unchanged.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), fs.ModePerm); nil != err {
+		return err
 	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if nil != err {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+	if _, err := tmp.Write(data); nil != err {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); nil != err {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); nil != err {
+		return err
+	}
+	// keep the permissions of the file being replaced, if any.
+	if info, err := os.Stat(path); err == nil {
+		if err := os.Chmod(tmp.Name(), info.Mode().Perm()); nil != err {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
 
-	if err := scan.Err(); nil != err {
+// Restore replaces the cache file at filePath with its backup, which is the
+// cache file as it was before it was last written. The replaced cache file
+// becomes the new backup, so restoring twice undoes the first restore.
+func Restore(filePath string) error {
+	release, err := lockFile(filePath, true)
+	if err != nil {
 		return err
 	}
+	defer release()
 
+	backup, err := os.ReadFile(filePath + BackupSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no backup of cache %s", filePath)
+	}
+	if err != nil {
+		return err
+	}
+	current, err := os.ReadFile(filePath)
+	switch {
+	case err == nil:
+		if err := writeFile(filePath+BackupSuffix, current); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	return writeFile(filePath, backup)
+}
+
+// load reads the cache file, which is either in the structured format or the
+// legacy plain-text format with one repository name per line.
+func (c *Cache) load() error {
+	c.List = []string{} // clear existing list
+	c.Meta = map[string]Repo{}
+	c.Groups = map[string]Group{}
+	c.Refreshed = time.Time{}
+
+	data, err := os.ReadFile(c.FilePath)
+	if nil != err {
+		return err
+	}
+
+	if !isDocument(data) {
+		scan := bufio.NewScanner(bytes.NewReader(data))
+		for scan.Scan() {
+			c.List = append(c.List, scan.Text())
+		}
+		return scan.Err()
+	}
+
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", c.FilePath, err)
+	}
+	if doc.Version > Version {
+		return fmt.Errorf("%s: unsupported cache version %d (want <= %d)",
+			c.FilePath, doc.Version, Version)
+	}
+	c.Refreshed = doc.Refreshed
+	for _, repo := range doc.Repos {
+		c.List = append(c.List, repo.Name)
+		c.Meta[repo.Name] = repo
+	}
+	for name, group := range doc.Groups {
+		c.Groups[name] = group
+	}
 	return nil
 }
 
+// isDocument reports whether data is in the structured cache format rather
+// than the legacy plain-text format. Repository names cannot begin with "{".
+func isDocument(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// write writes the given repositories and all groups to w in the structured
+// cache format.
+func (c *Cache) write(w io.Writer, repos []string) error {
+	doc := document{
+		Version:   Version,
+		Refreshed: c.Refreshed,
+		Repos:     make([]Repo, len(repos)),
+		Groups:    c.Groups,
+	}
+	for i, name := range repos {
+		doc.Repos[i] = c.Meta[name]
+		doc.Repos[i].Name = name
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// SaveGroup defines or replaces the named group and writes the cache file.
+func (c *Cache) SaveGroup(name string, group Group) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("undefined group name")
+	}
+	release, err := lockFile(c.FilePath, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// reload the cache in case it was refreshed by another process since it
+	// was loaded.
+	if err := c.load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	c.Groups[name] = group
+	return c.save(c.List)
+}
+
 func parseRepoList(r io.Reader) ([]string, error) {
 	scan := bufio.NewScanner(r)
-	repos := make([]string, 0)
-	seen := make(map[string]struct{})
+	names := make([]string, 0)
 	for scan.Scan() {
-		repo := strings.TrimSpace(scan.Text())
+		names = append(names, scan.Text())
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	return normalize(names)
+}
+
+// normalize returns the given repository names sorted, without surrounding
+// whitespace or slashes, empty names, or duplicates.
+//
+// Repositories nested in subdirectories of the server root are named by their
+// path relative to the root, with components separated by "/", e.g.,
+// "teams/avionics/fcs".
+func normalize(names []string) ([]string, error) {
+	repos := make([]string, 0, len(names))
+	seen := make(map[string]struct{})
+	for _, repo := range names {
+		repo = strings.Trim(strings.TrimSpace(repo), "/")
 		if repo == "" {
 			continue
 		}
-		if strings.ContainsAny(repo, `/\\`) {
+		if !validName(repo) {
 			return nil, fmt.Errorf("invalid repository name %q", repo)
 		}
 		if _, ok := seen[repo]; ok {
@@ -121,106 +440,74 @@ func parseRepoList(r io.Reader) ([]string, error) {
 		seen[repo] = struct{}{}
 		repos = append(repos, repo)
 	}
-	if err := scan.Err(); err != nil {
-		return nil, err
-	}
 	sort.Strings(repos)
 	return repos, nil
 }
 
-func (c *Cache) Match(
-	pattern []string, ignore []string, ignoreCase bool) ([]string, error) {
-
-	compile := func(re ...string) ([]*regexp.Regexp, error) {
-		x := make([]*regexp.Regexp, len(re))
-		for i, p := range re {
-			if ignoreCase {
-				p = "(?i)" + p
-			}
-			e, err := regexp.Compile(p)
-			if err != nil {
-				return nil, err
-			}
-			x[i] = e
+// validName reports whether repo is a valid repository path, which has no
+// backslashes and no empty, ".", or ".." components.
+func validName(repo string) bool {
+	if strings.Contains(repo, `\`) {
+		return false
+	}
+	for elem := range strings.SplitSeq(repo, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
 		}
-		return x, nil
 	}
+	return true
+}
 
-	expr, err := compile(pattern...)
-	if err != nil {
-		return nil, err
+// merge returns the metadata of prev updated with any metadata of next
+// reported by a Source.
+func merge(prev, next Repo) Repo {
+	if next.Revision != 0 {
+		prev.Revision = next.Revision
 	}
-	cond, err := compile(ignore...)
-	if err != nil {
-		return nil, err
+	if !next.Changed.IsZero() {
+		prev.Changed = next.Changed
 	}
-
-	m := []string{}
-	for _, repo := range c.List {
-		// First check if the repo matches ANY ignore pattern
-		avoid := false
-		for _, e := range cond {
-			if avoid = e.MatchString(string(repo)); avoid {
-				break // matched an ignore pattern, no need to test others
-			}
-		}
-		if avoid {
-			continue // skip this ignored repo
-		}
-		// Next check if the repo matches ALL select patterns
-		match := false
-		for _, e := range expr {
-			if match = e.MatchString(string(repo)); !match {
-				break // did not match some select pattern, no need to test others
-			}
-		}
-		if match {
-			// all tests passed, append this repo to returned slice
-			m = append(m, string(repo))
-		}
+	if next.UUID != "" {
+		prev.UUID = next.UUID
 	}
-	return m, nil
-}
-
-func (c *Cache) update(sshCmd string) (*os.File, error) {
-	argv := strings.Fields(sshCmd)
-	if len(argv) == 0 {
-		return nil, fmt.Errorf("undefined SSH command: set RESVN_SSH or use -S")
+	if next.Size != 0 {
+		prev.Size = next.Size
 	}
+	if next.Description != "" {
+		prev.Description = next.Description
+	}
+	if len(next.Tags) > 0 {
+		prev.Tags = next.Tags
+	}
+	return prev
+}
 
-	cmd := exec.Command(argv[0], argv[1:]...)
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		msg := strings.TrimSpace(stderr.String())
-		if msg != "" {
-			return nil, fmt.Errorf("%w: %s", err, msg)
-		}
+// update returns the repositories listed by src, along with the metadata of
+// any repositories retained from the existing cache.
+func (c *Cache) update(src Source) ([]string, error) {
+	listed, err := src.List()
+	if err != nil {
 		return nil, err
 	}
-
-	repos, err := parseRepoList(&stdout)
+	names := make([]string, len(listed))
+	for i, repo := range listed {
+		names[i] = repo.Name
+	}
+	repos, err := normalize(names)
 	if err != nil {
 		return nil, err
 	}
 	log.Printf("received %d repositories\n", len(repos))
 
-	// first write the response to a temporary file and then move it in place of
-	// our selected repo definitions file. in case of an error, we won't lose an
-	// existing repo definitions file.
-	repoFile, err := os.CreateTemp("", filepath.Base(c.FilePath))
-	if nil != err {
-		return nil, err
+	// retain the metadata of repositories in the existing cache, if any.
+	if err := c.load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("warning: discarding metadata from existing cache: %v\n", err)
 	}
-	defer repoFile.Close()
-
-	for _, repo := range repos {
-		if _, err := fmt.Fprintln(repoFile, repo); nil != err {
-			return nil, err
-		}
+	c.Diff = diff(c.List, repos)
+	for _, repo := range listed {
+		name := strings.Trim(strings.TrimSpace(repo.Name), "/")
+		c.Meta[name] = merge(c.Meta[name], repo)
 	}
 
-	return repoFile, nil
+	return repos, nil
 }
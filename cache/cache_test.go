@@ -1,8 +1,16 @@
 package cache
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseRepoList(t *testing.T) {
@@ -22,10 +30,473 @@ func TestParseRepoList(t *testing.T) {
 	}
 }
 
+func TestParseRepoListNested(t *testing.T) {
+	repos, err := parseRepoList(strings.NewReader("teams/avionics/fcs/\n/teams/ground\nalpha\n"))
+	if err != nil {
+		t.Fatalf("parseRepoList returned error: %v", err)
+	}
+	if got := strings.Join(repos, " "); got != "alpha teams/avionics/fcs teams/ground" {
+		t.Fatalf("got repos %q, want nested paths", got)
+	}
+}
+
 func TestParseRepoListRejectsInvalidNames(t *testing.T) {
-	for _, input := range []string{"alpha/beta\n", "alpha\\beta\n"} {
+	for _, input := range []string{"alpha\\beta\n", "alpha//beta\n", "alpha/../beta\n", "./alpha\n"} {
 		if _, err := parseRepoList(strings.NewReader(input)); err == nil {
 			t.Fatalf("parseRepoList(%q) returned nil error", input)
 		}
 	}
 }
+
+func TestSyncReadsLegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "repos.txt")
+	if err := os.WriteFile(path, []byte("alpha\nbeta\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", path, err)
+	}
+
+	c := New("repos.txt")
+	if err := c.Sync(path, false, nil); err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if strings.Join(c.List, " ") != "alpha beta" {
+		t.Fatalf("got repos %v, want [alpha beta]", c.List)
+	}
+}
+
+func TestSyncUpdateRetainsMetadata(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "repos.json")
+	data := `{
+  "version": 1,
+  "repos": [
+    {"name": "alpha", "revision": 42, "description": "Alpha", "tags": ["flight"]},
+    {"name": "gone", "revision": 7}
+  ]
+}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", path, err)
+	}
+	list := filepath.Join(dir, "list.sh")
+	if err := os.WriteFile(list, []byte("#!/bin/sh\nprintf 'beta\\nalpha\\n'\n"), 0o700); err != nil {
+		t.Fatalf("WriteFile(%q): %v", list, err)
+	}
+
+	c := New("repos.json")
+	if err := c.Sync(path, true, SSHSource(list)); err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if strings.Join(c.List, " ") != "alpha beta" {
+		t.Fatalf("got repos %v, want [alpha beta]", c.List)
+	}
+	alpha := c.Meta["alpha"]
+	if alpha.Revision != 42 || alpha.Description != "Alpha" || len(alpha.Tags) != 1 {
+		t.Fatalf("got metadata %+v, want retained alpha metadata", alpha)
+	}
+	if _, ok := c.Meta["gone"]; ok {
+		t.Fatal("metadata of removed repository was retained")
+	}
+}
+
+func TestSyncUpdateViaHTTP(t *testing.T) {
+	pages := map[string]string{
+		"/html/": `<html><head><title>Collection of Repositories</title></head>
+<body><h2>Collection of Repositories</h2><ul>
+<li><a href="../">..</a></li>
+<li><a href="zebra/">zebra/</a></li>
+<li><a href="alpha%20beta/">alpha beta/</a></li>
+<li><a href="http://other.example/gamma/">gamma/</a></li>
+<li><a href="README.txt">README.txt</a></li>
+</ul><em>Powered by Apache Subversion</em></body></html>`,
+		"/xml/": `<?xml version="1.0" encoding="utf-8"?>
+<?xml-stylesheet type="text/xsl" href="/svnindex.xsl"?>
+<svn version="1.14.2 (r1899510)" href="http://subversion.apache.org/">
+  <index path="/">
+    <dir name="zebra" href="zebra/" />
+    <dir name="alpha beta" href="alpha%20beta/" />
+  </index>
+</svn>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+	defer srv.Close()
+
+	for _, index := range []string{"html", "xml"} {
+		path := filepath.Join(t.TempDir(), "repos.json")
+		c := New("repos.json")
+		if err := c.Sync(path, true, HTTPSource(srv.URL+"/"+index+"/")); err != nil {
+			t.Fatalf("%s: Sync returned error: %v", index, err)
+		}
+		if got := strings.Join(c.List, ","); got != "alpha beta,zebra" {
+			t.Fatalf("%s: got repos %q, want %q", index, got, "alpha beta,zebra")
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "repos.json")
+	if err := New("repos.json").Sync(path, true, HTTPSource(srv.URL+"/missing/")); err == nil {
+		t.Fatal("Sync returned nil error for missing index")
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	dir := t.TempDir()
+	for _, repo := range []string{"alpha", "beta", "teams/fcs"} {
+		if err := os.MkdirAll(filepath.Join(dir, repo, "db"), 0o700); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, repo, "format"), []byte("5\n"), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "alpha", "db", "current"), []byte("123\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "alpha", "db", "uuid"), []byte("13f79535-47bb-0310-9956-ffa450edef68\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "notrepo"), 0o700); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	list := filepath.Join(dir, "list.txt")
+	if err := os.WriteFile(list, []byte("zebra\nalpha\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	for _, tc := range []struct {
+		spec string
+		want Source
+	}{
+		{"", nil},
+		{"ssh host -- ls", SSHSource("ssh host -- ls")},
+		{"ssh:ssh host -- ls", SSHSource("ssh host -- ls")},
+		{"https://svn.example/repos/", HTTPSource("https://svn.example/repos/")},
+		{"dir:" + dir, DirSource(dir)},
+		{"file:" + list, FileSource(list)},
+	} {
+		got, err := ParseSource(tc.spec)
+		if err != nil || got != tc.want {
+			t.Fatalf("ParseSource(%q) = %#v, %v, want %#v", tc.spec, got, err, tc.want)
+		}
+	}
+	if _, err := ParseSource("dir:"); err == nil {
+		t.Fatal("ParseSource returned nil error for empty path")
+	}
+
+	path := filepath.Join(dir, "repos.json")
+	c := New("repos.json")
+	if err := c.Sync(path, true, DirSource(dir)); err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if strings.Join(c.List, " ") != "alpha beta teams/fcs" {
+		t.Fatalf("got repos %v, want [alpha beta teams/fcs]", c.List)
+	}
+	if alpha := c.Meta["alpha"]; alpha.Revision != 123 || alpha.UUID == "" {
+		t.Fatalf("got metadata %+v, want revision and UUID from db", alpha)
+	}
+	if err := c.Sync(path, true, FileSource(list)); err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if strings.Join(c.List, " ") != "alpha zebra" || c.Meta["alpha"].Revision != 123 {
+		t.Fatalf("got repos %v (%+v), want [alpha zebra] with retained metadata", c.List, c.Meta["alpha"])
+	}
+}
+
+func TestSyncBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "repos.json")
+	first := filepath.Join(dir, "first.txt")
+	second := filepath.Join(dir, "second.txt")
+	for file, data := range map[string]string{first: "alpha\n", second: "beta\n"} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatalf("WriteFile(%q): %v", file, err)
+		}
+	}
+
+	c := New("repos.json")
+	if err := Restore(path); err == nil {
+		t.Fatal("Restore returned nil error without backup")
+	}
+	for _, list := range []string{first, second} {
+		if err := c.Sync(path, true, FileSource(list)); err != nil {
+			t.Fatalf("Sync returned error: %v", err)
+		}
+	}
+	if strings.Join(c.List, " ") != "beta" {
+		t.Fatalf("got repos %v, want [beta]", c.List)
+	}
+	if err := Restore(path); err != nil {
+		t.Fatalf("Restore returned error: %v", err)
+	}
+	if err := c.Sync(path, false, nil); err != nil || strings.Join(c.List, " ") != "alpha" {
+		t.Fatalf("got repos %v (err=%v) after Restore, want [alpha]", c.List, err)
+	}
+	if err := Restore(path); err != nil {
+		t.Fatalf("Restore returned error: %v", err)
+	}
+	if err := c.Sync(path, false, nil); err != nil || strings.Join(c.List, " ") != "beta" {
+		t.Fatalf("got repos %v (err=%v) after second Restore, want [beta]", c.List, err)
+	}
+
+	// replacing a directory fails, which must not be ignored.
+	if err := os.Mkdir(filepath.Join(dir, "dir.json"), 0o700); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := c.Sync(filepath.Join(dir, "dir.json"), true, FileSource(first)); err == nil {
+		t.Fatal("Sync returned nil error for failed rename")
+	}
+}
+
+func TestSyncConcurrentUpdates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "repos.json")
+	list := filepath.Join(dir, "list.txt")
+	if err := os.WriteFile(list, []byte("alpha\nbeta\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", list, err)
+	}
+
+	errs := make(chan error, 8)
+	for range cap(errs) {
+		go func() {
+			c := New("repos.json")
+			if err := c.Sync(path, true, FileSource(list)); err != nil {
+				errs <- err
+				return
+			}
+			if strings.Join(c.List, " ") != "alpha beta" {
+				errs <- fmt.Errorf("got repos %v, want [alpha beta]", c.List)
+				return
+			}
+			errs <- nil
+		}()
+	}
+	for range cap(errs) {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			t.Fatalf("temporary file %s was not removed", entry.Name())
+		}
+	}
+}
+
+func TestSyncRejectsNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "repos.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99, "repos": []}`), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", path, err)
+	}
+	if err := New("repos.json").Sync(path, false, nil); err == nil {
+		t.Fatal("Sync returned nil error for unsupported version")
+	}
+}
+
+func TestMatchGroups(t *testing.T) {
+	c := New("repos.json")
+	c.List = []string{"DAPA_Calc", "DAPA_DIOS", "DAPA_Project", "FCS_Core", "FCS_Sim", "Misc"}
+	c.Groups = map[string]Group{
+		"dapa":   {Match: []string{"^DAPA"}, Ignore: []string{"Calc", "DIOS"}},
+		"misc":   {Repos: []string{"Misc"}},
+		"flight": {Repos: []string{"FCS_Core"}, Groups: []string{"dapa", "misc"}},
+		"loop":   {Groups: []string{"loop2"}},
+		"loop2":  {Groups: []string{"loop"}},
+	}
+
+	for _, tc := range []struct {
+		pattern, ignore []string
+		want            string
+	}{
+		{[]string{"@group:dapa"}, nil, "DAPA_Project"},
+		{[]string{"@group:flight"}, nil, "DAPA_Project FCS_Core Misc"},
+		{[]string{"@group:flight", "^[DF]"}, nil, "DAPA_Project FCS_Core"},
+		{[]string{"."}, []string{"@group:flight"}, "DAPA_Calc DAPA_DIOS FCS_Sim"},
+	} {
+		got, err := c.Match(tc.pattern, tc.ignore, true)
+		if err != nil {
+			t.Fatalf("Match(%q, %q) returned error: %v", tc.pattern, tc.ignore, err)
+		}
+		if strings.Join(got, " ") != tc.want {
+			t.Fatalf("Match(%q, %q) = %v, want [%s]", tc.pattern, tc.ignore, got, tc.want)
+		}
+	}
+
+	for _, name := range []string{"loop", "undefined"} {
+		if _, err := c.Match([]string{GroupPrefix + name}, nil, true); err == nil {
+			t.Fatalf("Match(%q) returned nil error", GroupPrefix+name)
+		}
+	}
+}
+
+func TestMatchDialects(t *testing.T) {
+	c := New("repos.json")
+	c.List = []string{"foo", "foobar", "DAPA_Project", "DAPA_Calc", "a.b", "axb"}
+
+	for _, tc := range []struct {
+		dialect         Dialect
+		pattern, ignore []string
+		want            string
+	}{
+		{Regexp, []string{"foo"}, nil, "foo foobar"},
+		{Regexp, []string{"=foo"}, nil, "foo"},
+		{Regexp, []string{"a.b"}, nil, "a.b axb"},
+		{Exact, []string{"a.b"}, nil, "a.b"},
+		{Exact, []string{"re:^foo"}, []string{"FOO"}, "foobar"},
+		{Glob, []string{"dapa_*"}, []string{"*calc"}, "DAPA_Project"},
+		{Regexp, []string{"glob:DAPA_*"}, []string{"exact:DAPA_Calc"}, "DAPA_Project"},
+		{Prefix, []string{"foo"}, []string{"=foo"}, "foobar"},
+		{Regexp, []string{"prefix:DAPA"}, []string{"glob:*Calc"}, "DAPA_Project"},
+	} {
+		c.Dialect = tc.dialect
+		got, err := c.Match(tc.pattern, tc.ignore, true)
+		if err != nil {
+			t.Fatalf("Match(%q, %q) [%s] returned error: %v", tc.pattern, tc.ignore, tc.dialect, err)
+		}
+		if strings.Join(got, " ") != tc.want {
+			t.Fatalf("Match(%q, %q) [%s] = %v, want [%s]", tc.pattern, tc.ignore, tc.dialect, got, tc.want)
+		}
+	}
+
+	c.Dialect = Glob
+	if _, err := c.Match([]string{"[DAPA"}, nil, true); err == nil {
+		t.Fatal("Match returned nil error for malformed glob")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	c := New("repos.json")
+	c.List = []string{"DAPA_Calc", "DAPA_Project", "FCS_Core", "Misc"}
+
+	trace, err := c.Explain([]string{"^DAPA", "Proj"}, []string{"Calc"}, true, false)
+	if err != nil {
+		t.Fatalf("Explain returned error: %v", err)
+	}
+	want := []Trace{
+		{Repo: "DAPA_Calc", Matched: []string{"^DAPA"}, Missed: []string{"Proj"}, Ignored: "Calc"},
+		{Repo: "DAPA_Project", Matched: []string{"^DAPA", "Proj"}, Selected: true},
+		{Repo: "FCS_Core", Missed: []string{"^DAPA", "Proj"}},
+		{Repo: "Misc", Missed: []string{"^DAPA", "Proj"}},
+	}
+	if fmt.Sprint(trace) != fmt.Sprint(want) {
+		t.Fatalf("Explain = %+v, want %+v", trace, want)
+	}
+
+	trace, err = c.Explain([]string{"^DAPA", "Core", "D"}, nil, true, true)
+	if err != nil {
+		t.Fatalf("Explain returned error: %v", err)
+	}
+	var selected []string
+	for _, t := range trace {
+		if t.Selected {
+			selected = append(selected, t.Repo)
+		}
+	}
+	if strings.Join(selected, " ") != "DAPA_Calc DAPA_Project FCS_Core" {
+		t.Fatalf("got selected %v, want each repository matching any pattern once", selected)
+	}
+}
+
+func TestSyncMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "repos.txt")
+	list := filepath.Join(dir, "list.sh")
+	fail := filepath.Join(dir, "fail.sh")
+	for name, body := range map[string]string{
+		list: "#!/bin/sh\nprintf 'fresh\\n'\n",
+		fail: "#!/bin/sh\necho unreachable 1>&2\nexit 1\n",
+	} {
+		if err := os.WriteFile(name, []byte(body), 0o700); err != nil {
+			t.Fatalf("WriteFile(%q): %v", name, err)
+		}
+	}
+	writeStale := func() {
+		t.Helper()
+		if err := os.WriteFile(path, []byte("stale\n"), 0o600); err != nil {
+			t.Fatalf("WriteFile(%q): %v", path, err)
+		}
+		old := time.Now().Add(-2 * time.Hour)
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("Chtimes(%q): %v", path, err)
+		}
+	}
+
+	c := New("repos.txt")
+	c.MaxAge = 3 * time.Hour
+	writeStale()
+	if err := c.Sync(path, false, SSHSource(list)); err != nil || strings.Join(c.List, " ") != "stale" {
+		t.Fatalf("got repos %v (err=%v), want cache younger than MaxAge kept", c.List, err)
+	}
+
+	c.MaxAge = time.Hour
+	if err := c.Sync(path, false, SSHSource(fail)); err != nil || strings.Join(c.List, " ") != "stale" {
+		t.Fatalf("got repos %v (err=%v), want stale cache after failed refresh", c.List, err)
+	}
+	if err := c.Sync(path, false, SSHSource(list)); err != nil || strings.Join(c.List, " ") != "fresh" {
+		t.Fatalf("got repos %v (err=%v), want refreshed cache", c.List, err)
+	}
+
+	missing := filepath.Join(dir, "missing.txt")
+	if err := c.Sync(missing, false, SSHSource(fail)); err == nil {
+		t.Fatal("Sync returned nil error for missing cache and failed refresh")
+	}
+	if err := c.Sync(missing, false, SSHSource(list)); err != nil || strings.Join(c.List, " ") != "fresh" {
+		t.Fatalf("got repos %v (err=%v), want missing cache created", c.List, err)
+	}
+}
+
+func TestSyncMaxAgeIgnoresRewrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "repos.json")
+	list := filepath.Join(dir, "list.sh")
+	if err := os.WriteFile(list, []byte("#!/bin/sh\nprintf 'fresh\\n'\n"), 0o700); err != nil {
+		t.Fatalf("WriteFile(%q): %v", list, err)
+	}
+	refreshed := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	data := `{"version": 1, "refreshed": "` + refreshed + `", "repos": [{"name": "stale"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", path, err)
+	}
+
+	// saving a group rewrites the cache file without refreshing it.
+	c := New("repos.json")
+	c.FilePath = path
+	if err := c.SaveGroup("all", Group{Match: []string{"."}}); err != nil {
+		t.Fatalf("SaveGroup: %v", err)
+	}
+	c.MaxAge = time.Hour
+	if err := c.Sync(path, false, SSHSource(list)); err != nil || strings.Join(c.List, " ") != "fresh" {
+		t.Fatalf("got repos %v (err=%v), want cache refreshed despite rewrite", c.List, err)
+	}
+	if time.Since(c.Refreshed) > time.Minute {
+		t.Fatalf("got refreshed %v, want time of refresh recorded", c.Refreshed)
+	}
+	if _, ok := c.Groups["all"]; !ok {
+		t.Fatalf("got groups %v, want group kept across refresh", c.Groups)
+	}
+}
+
+func TestSyncReadCreatesNoLockFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "repos.txt")
+	c := New("repos.txt")
+	if err := c.Sync(path, false, nil); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Sync of missing cache returned %v, want ErrNotExist", err)
+	}
+	if err := os.WriteFile(path, []byte("alpha\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", path, err)
+	}
+	if err := c.Sync(path, false, nil); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if _, err := os.Stat(path + lockSuffix); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat(%q) returned %v, want no lock file created by reads", path+lockSuffix, err)
+	}
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// httpTimeout limits the time spent fetching a repository index.
+const httpTimeout = 30 * time.Second
+
+// hrefPattern matches the target of each link in an HTML document.
+var hrefPattern = regexp.MustCompile(`(?i)<a\s[^>]*href\s*=\s*["']([^"']+)["']`)
+
+// isListingURL reports whether source is the URL of a repository index rather
+// than an SSH command.
+func isListingURL(source string) bool {
+	source = strings.ToLower(strings.TrimSpace(source))
+	return strings.HasPrefix(source, "http://") ||
+		strings.HasPrefix(source, "https://")
+}
+
+// listHTTP returns the repository names in the SVNParentPath index served by
+// mod_dav_svn at rawURL. Both the default HTML index and the XML index (used
+// when SVNIndexXSLT is configured) are supported.
+func listHTTP(rawURL string) ([]string, error) {
+	client := &http.Client{Timeout: httpTimeout}
+	resp, err := client.Get(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+
+	var names []string
+	if isXMLIndex(body) {
+		names, err = parseXMLIndex(body)
+	} else {
+		names, err = parseHTMLIndex(body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", rawURL, err)
+	}
+	return parseRepoList(strings.NewReader(strings.Join(names, "\n")))
+}
+
+// isXMLIndex reports whether body is an XML repository index, which has root
+// element <svn>.
+func isXMLIndex(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	return bytes.HasPrefix(body, []byte("<?xml")) &&
+		bytes.Contains(body, []byte("<svn"))
+}
+
+// parseXMLIndex returns the names of the directories in an XML index, e.g.:
+//
+//	<svn version="1.14.2">
+//	  <index path="/">
+//	    <dir name="alpha" href="alpha/" />
+//	  </index>
+//	</svn>
+func parseXMLIndex(body []byte) ([]string, error) {
+	var index struct {
+		Dirs []struct {
+			Name string `xml:"name,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"index>dir"`
+	}
+	if err := xml.Unmarshal(body, &index); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(index.Dirs))
+	for _, dir := range index.Dirs {
+		name := dir.Name
+		if name == "" {
+			name = hrefName(dir.Href)
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// parseHTMLIndex returns the names of the directories linked from an HTML
+// index, e.g.:
+//
+//	<ul>
+//	  <li><a href="alpha/">alpha/</a></li>
+//	</ul>
+func parseHTMLIndex(body []byte) ([]string, error) {
+	var names []string
+	for _, m := range hrefPattern.FindAllSubmatch(body, -1) {
+		if name := hrefName(string(m[1])); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// hrefName returns the directory name referenced by a relative link, or the
+// empty string if the link does not reference a child directory (e.g., links
+// to parent directories, other hosts, or files).
+func hrefName(href string) string {
+	u, err := url.Parse(href)
+	if err != nil || u.IsAbs() || u.Host != "" ||
+		strings.HasPrefix(u.Path, "/") || !strings.HasSuffix(u.Path, "/") {
+		return ""
+	}
+	name := strings.TrimSuffix(u.Path, "/")
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return ""
+	}
+	return name
+}
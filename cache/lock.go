@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// lockSuffix is appended to the path of a cache file to name the file locked
+// while the cache is read or written.
+const lockSuffix = ".lock"
+
+// lockFile takes an advisory lock on the cache file at path, waiting for any
+// conflicting lock held by another process to be released. The lock is
+// exclusive if exclusive is true, or shared otherwise, and is released by
+// calling release.
+//
+// Only an exclusive lock creates the lock file. Since the cache file is always
+// replaced atomically, a shared lock is only advisory: if the lock file does
+// not exist or cannot be opened (e.g., the cache is in a read-only directory),
+// the cache is read without a lock.
+func lockFile(path string, exclusive bool) (release func(), err error) {
+	name := path + lockSuffix
+	var f *os.File
+	if exclusive {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			return nil, err
+		}
+		if f, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+			return nil, err
+		}
+	} else if f, err = os.Open(name); err != nil {
+		return func() {}, nil
+	}
+	if err := lock(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlock(f)
+		f.Close()
+	}, nil
+}
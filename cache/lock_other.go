@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package cache
+
+import "os"
+
+// lock does nothing on platforms without support for advisory file locks.
+func lock(f *os.File, exclusive bool) error { return nil }
+
+func unlock(f *os.File) error { return nil }
@@ -0,0 +1,273 @@
+package cache
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// GroupPrefix identifies a pattern that selects the members of a named group,
+// e.g., "@group:flight".
+const GroupPrefix = "@group:"
+
+// Dialect is the syntax of a pattern given to Match.
+type Dialect int
+
+const (
+	Regexp Dialect = iota // regular expression matching any part of a name
+	Glob                  // shell glob matching an entire name, e.g., "DAPA_*"
+	Exact                 // entire name
+	Prefix                // leading part of a name
+)
+
+// dialectPrefix identifies a pattern in each Dialect regardless of the
+// default Dialect of the Cache, e.g., "glob:DAPA_*". A pattern beginning with
+// "=" is also in the Exact dialect.
+var dialectPrefix = map[Dialect]string{
+	Regexp: "re:",
+	Glob:   "glob:",
+	Exact:  "exact:",
+	Prefix: "prefix:",
+}
+
+// ParseDialect returns the Dialect with the given name, which is one of
+// "regex", "glob", "exact", or "prefix".
+func ParseDialect(name string) (Dialect, error) {
+	for _, d := range []Dialect{Regexp, Glob, Exact, Prefix} {
+		if name == d.String() {
+			return d, nil
+		}
+	}
+	return Regexp, fmt.Errorf("invalid pattern dialect %q", name)
+}
+
+func (d Dialect) String() string {
+	switch d {
+	case Glob:
+		return "glob"
+	case Exact:
+		return "exact"
+	case Prefix:
+		return "prefix"
+	default:
+		return "regex"
+	}
+}
+
+// Qualify returns pattern with the prefix of dialect d, unless it already
+// begins with the prefix of any dialect or group. A qualified pattern has the
+// same meaning regardless of the default Dialect of a Cache.
+func Qualify(pattern string, d Dialect) string {
+	if d == Regexp {
+		return pattern
+	}
+	if _, _, ok := cutDialect(pattern, d); ok ||
+		strings.HasPrefix(pattern, GroupPrefix) {
+		return pattern
+	}
+	return dialectPrefix[d] + pattern
+}
+
+// cutDialect returns the Dialect of pattern and pattern without the prefix
+// identifying that Dialect. If pattern has no such prefix, it is returned
+// unchanged with Dialect d and ok is false.
+func cutDialect(pattern string, d Dialect) (p string, dialect Dialect, ok bool) {
+	for dialect, prefix := range dialectPrefix {
+		if p, ok := strings.CutPrefix(pattern, prefix); ok {
+			return p, dialect, true
+		}
+	}
+	if p, ok := strings.CutPrefix(pattern, "="); ok {
+		return p, Exact, true
+	}
+	return pattern, d, false
+}
+
+// predicate reports whether a repository name satisfies some pattern.
+type predicate func(repo string) bool
+
+// compile returns a predicate matching names according to the given pattern,
+// which is in Dialect d unless it begins with the prefix of another Dialect.
+func compile(pattern string, d Dialect, ignoreCase bool) (predicate, error) {
+	pattern, d, _ = cutDialect(pattern, d)
+	fold := func(s string) string { return s }
+	if ignoreCase {
+		fold = strings.ToLower
+	}
+	switch d {
+	case Glob:
+		pattern = fold(pattern)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: %q", err, pattern)
+		}
+		return func(repo string) bool {
+			ok, _ := path.Match(pattern, fold(repo))
+			return ok
+		}, nil
+	case Exact:
+		pattern = fold(pattern)
+		return func(repo string) bool { return fold(repo) == pattern }, nil
+	case Prefix:
+		pattern = fold(pattern)
+		return func(repo string) bool {
+			return strings.HasPrefix(fold(repo), pattern)
+		}, nil
+	default:
+		if ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		e, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return e.MatchString, nil
+	}
+}
+
+// Match returns the repositories matching all of the select patterns and none
+// of the ignore patterns, in cache order.
+//
+// Patterns are in the default Dialect of the Cache unless they begin with the
+// prefix of another Dialect (e.g., "glob:DAPA_*" or "=DAPA_Project"). Patterns
+// beginning with GroupPrefix match the members of the named group.
+func (c *Cache) Match(
+	pattern []string, ignore []string, ignoreCase bool) ([]string, error) {
+	return c.match(pattern, ignore, ignoreCase, c.Dialect, map[string]bool{})
+}
+
+// Trace explains why a repository was or was not selected by Explain.
+type Trace struct {
+	Repo     string
+	Matched  []string // select patterns matching the repository
+	Missed   []string // select patterns not matching the repository
+	Ignored  string   // first ignore pattern matching the repository, if any
+	Selected bool
+}
+
+// Explain returns a Trace for every repository in the cache, in cache order,
+// using the same patterns as Match.
+//
+// A repository is selected if it matches none of the ignore patterns and all
+// of the select patterns, or if matchAny is true, at least one of them.
+func (c *Cache) Explain(pattern []string, ignore []string,
+	ignoreCase bool, matchAny bool) ([]Trace, error) {
+	return c.explain(pattern, ignore, ignoreCase, matchAny, c.Dialect, map[string]bool{})
+}
+
+// match is Match with the default Dialect of patterns and the set of groups
+// currently being resolved, which is used to detect groups that are members
+// of themselves.
+func (c *Cache) match(pattern []string, ignore []string, ignoreCase bool,
+	dialect Dialect, resolving map[string]bool) ([]string, error) {
+
+	trace, err := c.explain(pattern, ignore, ignoreCase, false, dialect, resolving)
+	if err != nil {
+		return nil, err
+	}
+	m := []string{}
+	for _, t := range trace {
+		if t.Selected {
+			m = append(m, t.Repo)
+		}
+	}
+	return m, nil
+}
+
+func (c *Cache) explain(pattern []string, ignore []string, ignoreCase bool,
+	matchAny bool, dialect Dialect, resolving map[string]bool) ([]Trace, error) {
+
+	compileAll := func(pat ...string) ([]predicate, error) {
+		x := make([]predicate, len(pat))
+		for i, p := range pat {
+			if name, ok := strings.CutPrefix(p, GroupPrefix); ok {
+				member, err := c.members(name, ignoreCase, resolving)
+				if err != nil {
+					return nil, err
+				}
+				x[i] = func(repo string) bool { return member[repo] }
+				continue
+			}
+			e, err := compile(p, dialect, ignoreCase)
+			if err != nil {
+				return nil, err
+			}
+			x[i] = e
+		}
+		return x, nil
+	}
+
+	expr, err := compileAll(pattern...)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := compileAll(ignore...)
+	if err != nil {
+		return nil, err
+	}
+
+	trace := make([]Trace, len(c.List))
+	for i, repo := range c.List {
+		t := Trace{Repo: repo}
+		// record the first ignore pattern matching the repo, if any
+		for j, e := range cond {
+			if e(repo) {
+				t.Ignored = ignore[j]
+				break
+			}
+		}
+		// record every select pattern, whether or not the repo was ignored
+		for j, e := range expr {
+			if e(repo) {
+				t.Matched = append(t.Matched, pattern[j])
+			} else {
+				t.Missed = append(t.Missed, pattern[j])
+			}
+		}
+		t.Selected = t.Ignored == "" && len(t.Matched) > 0 &&
+			(matchAny || len(t.Missed) == 0)
+		trace[i] = t
+	}
+	return trace, nil
+}
+
+// members returns the set of repositories in the named group.
+func (c *Cache) members(name string, ignoreCase bool,
+	resolving map[string]bool) (map[string]bool, error) {
+
+	group, ok := c.Groups[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined group %q", name)
+	}
+	if resolving[name] {
+		return nil, fmt.Errorf("group %q is a member of itself", name)
+	}
+	resolving[name] = true
+	defer delete(resolving, name)
+
+	member := map[string]bool{}
+	for _, repo := range group.Repos {
+		member[repo] = true
+	}
+	if len(group.Match) > 0 {
+		// unqualified patterns of a group are always regular expressions, so
+		// that its members do not depend on the default Dialect.
+		m, err := c.match(group.Match, group.Ignore, ignoreCase, Regexp, resolving)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %w", name, err)
+		}
+		for _, repo := range m {
+			member[repo] = true
+		}
+	}
+	for _, sub := range group.Groups {
+		m, err := c.members(sub, ignoreCase, resolving)
+		if err != nil {
+			return nil, err
+		}
+		for repo := range m {
+			member[repo] = true
+		}
+	}
+	return member, nil
+}
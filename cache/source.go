@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Source lists the repositories available on a server.
+//
+// Only the Name of each listed Repo is required. Any other metadata reported
+// by a Source replaces the metadata retained in the cache.
+type Source interface {
+	List() ([]Repo, error)
+}
+
+// sourceScheme identifies the type of Source given to ParseSource, e.g.,
+// "dir:/srv/svn/repos". A new type of Source is added by registering a
+// constructor with its scheme here.
+var sourceScheme = map[string]func(spec string) Source{
+	"ssh:":  func(spec string) Source { return SSHSource(spec) },
+	"dir:":  func(spec string) Source { return DirSource(spec) },
+	"file:": func(spec string) Source { return FileSource(spec) },
+}
+
+// ParseSource returns the Source described by spec, which is an SSH command,
+// an HTTP(S) URL of a repository index, or one of the following:
+//
+//	"ssh:<command>"  ┆ SSH command printing one repository name per line
+//	"dir:<path>"     ┆ local directory containing repositories
+//	"file:<path>"    ┆ static file listing one repository name per line
+//
+// A nil Source is returned if spec is empty.
+func ParseSource(spec string) (Source, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	if isListingURL(spec) {
+		return HTTPSource(spec), nil
+	}
+	for scheme, source := range sourceScheme {
+		if arg, ok := strings.CutPrefix(spec, scheme); ok {
+			if arg = strings.TrimSpace(arg); arg == "" {
+				return nil, fmt.Errorf("invalid repository source %q", spec)
+			}
+			return source(arg), nil
+		}
+	}
+	return SSHSource(spec), nil
+}
+
+// SSHSource is a command (typically using SSH) that prints the name of each
+// repository, one per line.
+type SSHSource string
+
+func (s SSHSource) List() ([]Repo, error) {
+	argv := strings.Fields(string(s))
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("undefined SSH command: set RESVN_SSH or use -S")
+	}
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	return repoNames(parseRepoList(&stdout))
+}
+
+// HTTPSource is the URL of a repository index served by a server configured
+// with SVNParentPath.
+type HTTPSource string
+
+func (s HTTPSource) List() ([]Repo, error) {
+	return repoNames(listHTTP(string(s)))
+}
+
+// FileSource is the path of a file listing the name of each repository, one
+// per line. A file in the structured cache format is also accepted.
+type FileSource string
+
+func (s FileSource) List() ([]Repo, error) {
+	data, err := os.ReadFile(string(s))
+	if err != nil {
+		return nil, err
+	}
+	if !isDocument(data) {
+		return repoNames(parseRepoList(bytes.NewReader(data)))
+	}
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", s, err)
+	}
+	return doc.Repos, nil
+}
+
+// DirSource is the path of a local directory containing repositories created
+// with "svnadmin create", such as the directory given by SVNParentPath.
+//
+// Repositories nested in subdirectories are also listed, named by their path
+// relative to the directory. Hidden directories and the contents of
+// repositories are not searched. The youngest revision and UUID of each FSFS
+// repository are read from its "db" directory.
+type DirSource string
+
+func (s DirSource) List() ([]Repo, error) {
+	root := filepath.Clean(string(s))
+	var repos []Repo
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() || path == root {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !isRepository(path) {
+			return nil
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		repos = append(repos, readRepository(filepath.ToSlash(name), path))
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// isRepository reports whether dir is a repository created with
+// "svnadmin create", which contains a "format" file and "db" directory.
+func isRepository(dir string) bool {
+	format, err := os.Stat(filepath.Join(dir, "format"))
+	if err != nil || !format.Mode().IsRegular() {
+		return false
+	}
+	db, err := os.Stat(filepath.Join(dir, "db"))
+	return err == nil && db.IsDir()
+}
+
+// readRepository returns the named repository in dir with any metadata that
+// can be read from its "db" directory.
+func readRepository(name, dir string) Repo {
+	repo := Repo{Name: name}
+	firstLine := func(file string) string {
+		f, err := os.Open(filepath.Join(dir, "db", file))
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		scan := bufio.NewScanner(f)
+		scan.Scan()
+		return strings.TrimSpace(scan.Text())
+	}
+	// db/current begins with the youngest revision in FSFS repositories.
+	if fields := strings.Fields(firstLine("current")); len(fields) > 0 {
+		if rev, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			repo.Revision = rev
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dir, "db", "current")); err == nil {
+		repo.Changed = info.ModTime().UTC()
+	}
+	repo.UUID = firstLine("uuid")
+	return repo
+}
+
+// repoNames returns a Repo with each of the given names.
+func repoNames(names []string, err error) ([]Repo, error) {
+	if err != nil {
+		return nil, err
+	}
+	repos := make([]Repo, len(names))
+	for i, name := range names {
+		repos[i] = Repo{Name: name}
+	}
+	return repos, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ardnew/resvn/cache"
+)
+
+const (
+	configName   = ".resvn.json"
+	configDir    = "resvn"
+	configFile   = "config.json"
+	profileIdent = "RESVN_PROFILE"
+)
+
+// envFlags maps the name of each flag to the environment variable defining its
+// default value.
+var envFlags = map[string]string{
+	"s": svnURLIdent,
+	"W": webURLIdent,
+	"S": svnSSHIdent,
+	"a": svnARGIdent,
+	"p": profileIdent,
+}
+
+// profile is a named set of settings for a single SVN server.
+//
+// Each field overrides the environment variable of the corresponding flag,
+// and is itself overridden by the flag if given on the command line.
+type profile struct {
+	Server string `json:"server,omitempty"` // -s
+	Web    string `json:"web,omitempty"`    // -W
+	SSH    string `json:"ssh,omitempty"`    // -S
+	Source string `json:"source,omitempty"` // -S, takes precedence over SSH
+	Args   string `json:"args,omitempty"`   // -a
+	Cache  string `json:"cache,omitempty"`  // -f
+}
+
+// document is the content of a single configuration file.
+type document struct {
+	path     string
+	Flags    map[string]any     `json:"flags,omitempty"`
+	Profiles map[string]profile `json:"profiles,omitempty"`
+}
+
+// config is the merged content of all configuration files.
+type config struct {
+	docs     []*document        // in increasing order of precedence
+	Profiles map[string]profile // from all documents
+	origin   map[string]string  // path of the document defining each profile
+}
+
+// configPaths returns the paths of the user configuration file and the
+// nearest project configuration file, in increasing order of precedence.
+//
+// The user configuration file is located in the user's configuration
+// directory (e.g., $XDG_CONFIG_HOME). The project configuration file is
+// discovered by searching the working directory and each of its parents.
+func configPaths() []string {
+	var paths []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, configDir, configFile))
+	}
+	if dir, err := os.Getwd(); err == nil {
+		for {
+			path := filepath.Join(dir, configName)
+			if _, err := os.Stat(path); err == nil {
+				paths = append(paths, path)
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return paths
+}
+
+// loadConfig reads the configuration files at the given paths, in increasing
+// order of precedence. Missing files are ignored.
+func loadConfig(paths ...string) (*config, error) {
+	cfg := &config{
+		Profiles: map[string]profile{},
+		origin:   map[string]string{},
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		doc := &document{path: path}
+		if err := json.Unmarshal(data, doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for name, prof := range doc.Profiles {
+			cfg.Profiles[name] = prof
+			cfg.origin[name] = path
+		}
+		cfg.docs = append(cfg.docs, doc)
+	}
+	return cfg, nil
+}
+
+// flagValue returns the string representation of a flag value read from a
+// configuration file.
+func flagValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		s := make([]string, len(v))
+		for i, e := range v {
+			var err error
+			if s[i], err = flagValue(e); err != nil {
+				return "", err
+			}
+		}
+		return strings.Join(s, " "), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// profileNames returns the names of all defined profiles in sorted order.
+func (c *config) profileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// printConfig prints the effective value of each flag and the source defining
+// it, followed by the name of each profile and the file defining it.
+func printConfig(w io.Writer, set *flag.FlagSet, sources map[string]string, cfg *config, format string) error {
+	source := func(name string) string {
+		if src, ok := sources[name]; ok {
+			return src
+		}
+		return "default"
+	}
+	if format == formatJSON {
+		var err error
+		set.VisitAll(func(f *flag.Flag) {
+			if err == nil {
+				err = writeJSON(w, map[string]string{
+					"flag":   f.Name,
+					"value":  f.Value.String(),
+					"source": source(f.Name),
+				})
+			}
+		})
+		for _, name := range cfg.profileNames() {
+			if err == nil {
+				err = writeJSON(w, map[string]string{
+					"profile": name,
+					"source":  cfg.origin[name],
+				})
+			}
+		}
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "FLAG\tVALUE\tSOURCE"+newline)
+	set.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(tw, "-%s\t%s\t%s"+newline, f.Name, f.Value, source(f.Name))
+	})
+	if names := cfg.profileNames(); len(names) > 0 {
+		fmt.Fprint(tw, newline+"PROFILE\t\tSOURCE"+newline)
+		for _, name := range names {
+			fmt.Fprintf(tw, "%s\t\t%s"+newline, name, cfg.origin[name])
+		}
+	}
+	return tw.Flush()
+}
+
+// site is a single SVN server and the repositories cached for it.
+type site struct {
+	profile   string // name of the profile defining the site, if any
+	svnPrefix string // prefix of repository URLs
+	webPrefix string // prefix of Web browsing URLs
+	source    string // SSH command or other repository source spec
+	svnArgs   svnArg
+	cache     *cache.Cache
+	cacheFile string
+}
+
+// url returns the repository URL of repo, or its Web browsing URL if web is
+// true.
+func (s *site) url(repo string, web bool) string {
+	if web {
+		return s.webPrefix + "/" + repo
+	}
+	return s.svnPrefix + "/" + repo
+}
+
+// setPrefix constructs the repository and Web browsing URL prefixes from the
+// given server and Web URLs.
+func (s *site) setPrefix(baseURL, webBaseURL string) error {
+	if strings.TrimSpace(baseURL) == "" {
+		if s.profile != "" {
+			return fmt.Errorf("undefined server URL in profile %q: try help (-h)", s.profile)
+		}
+		return fmt.Errorf("undefined server URL: try help (-h)")
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+	s.svnPrefix = baseURL + "/" + svnURLRoot
+	s.webPrefix = baseURL + "/" + webURLRoot
+	if strings.TrimSpace(webBaseURL) != "" {
+		s.webPrefix = strings.TrimRight(webBaseURL, "/")
+	}
+	return nil
+}
+
+// target is a repository matched on a particular site, or a working copy of
+// that repository.
+type target struct {
+	site *site
+	repo string
+	wc   string // working copy of the repository, if any
+}
+
+// vars returns the named parameters expanded in arguments for repository t,
+// which is match n (from 0) of count matched repositories. Parameters without
+// a value, e.g., "wc" for a repository without a working copy or "rev" for a
+// repository whose youngest revision is not cached, are omitted.
+func (t target) vars(n, count int) map[string]string {
+	vars := map[string]string{
+		"profile": t.site.profile,
+		"repo":    t.repo,
+		"index":   strconv.Itoa(n + 1),
+		"count":   strconv.Itoa(count),
+		"server":  t.site.svnPrefix,
+		"web":     t.site.url(t.repo, true),
+	}
+	if t.wc != "" {
+		vars["wc"] = t.wc
+	}
+	if meta := t.site.cache.Meta[t.repo]; meta.Revision > 0 {
+		vars["rev"] = strconv.FormatInt(meta.Revision, 10)
+	}
+	return vars
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ardnew/resvn/cache"
+)
+
+// decision returns a short description of the outcome of trace t.
+func decision(t cache.Trace) string {
+	switch {
+	case t.Selected:
+		return "selected"
+	case t.Ignored != "":
+		return "ignored"
+	default:
+		return "skipped"
+	}
+}
+
+// printTrace prints why each repository of a profile was selected or skipped.
+func printTrace(w io.Writer, profile string, trace []cache.Trace, format string) error {
+	if format == formatJSON {
+		for _, t := range trace {
+			if err := writeJSON(w, struct {
+				Profile  string   `json:"profile,omitempty"`
+				Name     string   `json:"name"`
+				Decision string   `json:"decision"`
+				Matched  []string `json:"matched,omitempty"`
+				Missed   []string `json:"missed,omitempty"`
+				Ignored  string   `json:"ignored,omitempty"`
+			}{profile, t.Repo, decision(t), t.Matched, t.Missed, t.Ignored}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	list := func(s []string) string {
+		if len(s) == 0 {
+			return "-"
+		}
+		return strings.Join(s, ", ")
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if profile != "" {
+		fmt.Fprintf(tw, "PROFILE %s"+newline, profile)
+	}
+	fmt.Fprint(tw, "REPOSITORY\tDECISION\tMATCHED\tMISSED\tIGNORED"+newline)
+	for _, t := range trace {
+		ignored := t.Ignored
+		if ignored == "" {
+			ignored = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s"+newline,
+			t.Repo, decision(t), list(t.Matched), list(t.Missed), ignored)
+	}
+	return tw.Flush()
+}
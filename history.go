@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// logEntry is a single revision in the log of a repository.
+type logEntry struct {
+	Profile  string    `json:"profile,omitempty" xml:"-"`
+	Name     string    `json:"name" xml:"-"`
+	URL      string    `json:"url" xml:"-"`
+	Revision int64     `json:"revision" xml:"revision,attr"`
+	Author   string    `json:"author" xml:"author"`
+	Date     time.Time `json:"date" xml:"date"`
+	Message  string    `json:"message" xml:"msg"`
+}
+
+// logFilter selects the log entries to print.
+type logFilter struct {
+	authors  []string       // any of these authors, or any author if empty
+	from, to time.Time      // date range [from, to), unbounded if zero
+	message  *regexp.Regexp // message pattern, or any message if nil
+}
+
+// parseDateRange returns the dates of a range "from..to", where either date
+// may be omitted, e.g., "2026-01-01..". Dates are given as "2006-01-02" or in
+// RFC 3339 format. A date without time includes that entire day, and a single
+// date selects only that day.
+func parseDateRange(s string) (from, to time.Time, err error) {
+	if strings.TrimSpace(s) == "" {
+		return
+	}
+	lo, hi, ok := strings.Cut(s, "..")
+	if !ok {
+		hi = lo
+	}
+	parse := func(s string, end bool) (time.Time, error) {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return time.Time{}, nil
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t, nil
+		}
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return t, fmt.Errorf("error: invalid date %q (want YYYY-MM-DD)", s)
+		}
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	if from, err = parse(lo, false); err != nil {
+		return
+	}
+	to, err = parse(hi, true)
+	return
+}
+
+func (f logFilter) match(e logEntry) bool {
+	switch {
+	case len(f.authors) > 0 && !slices.Contains(f.authors, e.Author):
+		return false
+	case !f.from.IsZero() && e.Date.Before(f.from):
+		return false
+	case !f.to.IsZero() && !e.Date.Before(f.to):
+		return false
+	case f.message != nil && !f.message.MatchString(e.Message):
+		return false
+	}
+	return true
+}
+
+// revisionRange returns the argument of "svn log -r" that selects at least the
+// revisions in the date range of f, or the empty string for all revisions.
+func (f logFilter) revisionRange() string {
+	if f.from.IsZero() && f.to.IsZero() {
+		return ""
+	}
+	lo, hi := "1", "HEAD"
+	if !f.from.IsZero() {
+		lo = "{" + f.from.UTC().Format(time.RFC3339) + "}"
+	}
+	if !f.to.IsZero() {
+		hi = "{" + f.to.UTC().Format(time.RFC3339) + "}"
+	}
+	return hi + ":" + lo
+}
+
+// history collects the log of each repository in match, running up to workers
+// "svn log" commands at once, and returns the entries selected by filter
+// ordered by date, newest first. The given arguments are added to each "svn
+// log" command, and if none of them is a URL beginning with "@", the log of
+// the repository root is collected.
+func history(match []target, arg []string, filter logFilter, workers int) ([]logEntry, error) {
+	logs := make([][]logEntry, len(match))
+	errs := make([]error, len(match))
+	forEach(len(match), workers, func(i int) {
+		logs[i], errs[i] = repoLog(match[i], match[i].vars(i, len(match)), arg, filter)
+	})
+
+	var merged []logEntry
+	for i := range match {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("error: %s: %w", match[i].repo, errs[i])
+		}
+		merged = append(merged, logs[i]...)
+	}
+	slices.SortStableFunc(merged, func(a, b logEntry) int {
+		return b.Date.Compare(a.Date)
+	})
+	return merged, nil
+}
+
+// repoLog returns the entries of the log of repository t selected by filter.
+// The given arguments are expanded with named parameters vars.
+func repoLog(t target, vars map[string]string, arg []string, filter logFilter) ([]logEntry, error) {
+	url := t.site.url(t.repo, false)
+	cmd := append(append([]string{}, t.site.svnArgs...), "log", "--xml")
+	if r := filter.revisionRange(); r != "" {
+		cmd = append(cmd, "-r", r)
+	}
+	hasURL := false
+	for i, a := range arg {
+		prec := ""
+		if i > 0 {
+			prec = cmd[len(cmd)-1]
+		}
+		hasURL = hasURL || isURLArg(a)
+		cmd = append(cmd, expand(a, url, t.repo, prec, vars))
+	}
+	if !hasURL {
+		cmd = append(cmd, url)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := runSVN("", &stdout, &stderr, cmd...); err != nil {
+		return nil, err
+	}
+	var out struct {
+		Entries []logEntry `xml:"logentry"`
+	}
+	if err := xml.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("invalid output from svn log: %w", err)
+	}
+	var entries []logEntry
+	for _, e := range out.Entries {
+		if !filter.match(e) {
+			continue
+		}
+		e.Profile, e.Name, e.URL = t.site.profile, t.repo, url
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// printHistory writes the given log entries to w in the given format.
+func printHistory(w io.Writer, entries []logEntry, format string) error {
+	if format == formatJSON {
+		for _, e := range entries {
+			if err := writeJSON(w, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "DATE\tREPOSITORY\tREVISION\tAUTHOR\tMESSAGE"+newline)
+	for _, e := range entries {
+		msg, _, _ := strings.Cut(strings.TrimSpace(e.Message), "\n")
+		fmt.Fprintf(tw, "%s\t%s\tr%d\t%s\t%s"+newline,
+			e.Date.Local().Format(time.DateTime), e.Name, e.Revision, e.Author, strings.TrimSpace(msg))
+	}
+	return tw.Flush()
+}
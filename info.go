@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// svnInfo is an entry in the output of "svn info --xml".
+type svnInfo struct {
+	Kind     string `xml:"kind,attr"`
+	Path     string `xml:"path,attr"`
+	Revision int64  `xml:"revision,attr"`
+	URL      string `xml:"url"`
+	RelURL   string `xml:"relative-url"`
+	Root     string `xml:"repository>root"`
+	UUID     string `xml:"repository>uuid"`
+	WCRoot   string `xml:"wc-info>wcroot-abspath"`
+	Commit   struct {
+		Revision int64  `xml:"revision,attr"`
+		Author   string `xml:"author"`
+		Date     string `xml:"date"`
+	} `xml:"commit"`
+}
+
+// parseInfo returns the entries in the output of "svn info --xml".
+func parseInfo(data []byte) ([]svnInfo, error) {
+	var info struct {
+		Entries []svnInfo `xml:"entry"`
+	}
+	if err := xml.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("error: invalid output from svn info: %w", err)
+	}
+	return info.Entries, nil
+}
+
+// queryInfo runs "svn info --xml" with the given global options on each of the
+// given working copy paths or URLs and returns the entries reported. If rev is
+// not empty, the entries are reported as of revision rev.
+func queryInfo(svnArgs []string, rev string, target ...string) ([]svnInfo, error) {
+	var stdout, stderr bytes.Buffer
+	arg := append(append([]string{}, svnArgs...), "info", "--xml")
+	if rev != "" {
+		arg = append(arg, "-r", rev)
+	}
+	arg = append(append(arg, "--"), target...)
+	if err := runSVN("", &stdout, &stderr, arg...); err != nil {
+		return nil, fmt.Errorf("error: svn info: %w", err)
+	}
+	return parseInfo(stdout.Bytes())
+}
+
+// sameURL reports whether a and b are the same URL, ignoring any trailing
+// slashes.
+func sameURL(a, b string) bool {
+	return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+}
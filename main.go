@@ -9,8 +9,12 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"text/template"
 	"unicode"
 
 	"github.com/ardnew/resvn/cache"
@@ -127,11 +131,30 @@ func usage(out io.Writer, set *flag.FlagSet) {
 	fmt.Fprintln(out)
 	fmt.Fprint(out, formatDef(margin-4, "@", "", "repository URL (must prefix a word)"))
 	fmt.Fprint(out, formatDef(margin-4, "%", "", "path relative to server root"))
-	fmt.Fprint(out, formatDef(margin-4, "^", "", "repository base name"))
+	fmt.Fprint(out, formatDef(margin-4, "^", "", "repository base name (last component of \"{repo}\")"))
 	fmt.Fprint(out, formatDef(margin-4, "&", "", "preceding URL/path argument"))
 	fmt.Fprint(out, formatDef(margin-4, "$", "", "last path component (basename) of \"&\""))
 	fmt.Fprint(out, formatDef(margin-4, "!", "", "parent path component (basename of dirname) of \"&\""))
 	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("The following named parameters are enclosed in braces and may",
+		"appear anywhere in an argument."))
+	fmt.Fprintln(out)
+	fmt.Fprint(out, formatDef(margin+4, "{profile}", "", "name of the profile defining the repository"))
+	fmt.Fprint(out, formatDef(margin+4, "{repo}", "", "repository path relative to server root"))
+	fmt.Fprint(out, formatDef(margin+4, "{wc}", "", "path of the working copy (with flag \"-C\")"))
+	fmt.Fprint(out, formatDef(margin+4, "{pin}", "", "revision recorded in snapshot (with flag \"-P\")"))
+	fmt.Fprint(out, formatDef(margin+4, "{rev}", "", "youngest revision of the repository in cache"))
+	fmt.Fprint(out, formatDef(margin+4, "{index}", "", "position of the repository in all matches, from 1"))
+	fmt.Fprint(out, formatDef(margin+4, "{count}", "", "number of matched repositories"))
+	fmt.Fprint(out, formatDef(margin+4, "{server}", "", "server URL prefix of all repository URLs"))
+	fmt.Fprint(out, formatDef(margin+4, "{web}", "", "Web browsing URL of the repository"))
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("A named parameter without a value (e.g., \"{wc}\" without flag",
+		"\"-C\") is left unexpanded. A parameter character or brace is passed",
+		"literally if doubled, e.g., \"50%%\", \"{{pin}}\", or a leading \"@@\", and an",
+		"argument beginning with \"=\" is passed verbatim (without the \"=\"), e.g.,",
+		"\"=fix 50% of cases & more\"."))
+	fmt.Fprintln(out)
 	fmt.Fprintln(out)
 	fmt.Fprintln(out, "╭──────────────────────────────────────────────────────────────────────────────╮")
 	fmt.Fprintln(out, "│  NOTES                                                                       │")
@@ -147,9 +170,17 @@ func usage(out io.Writer, set *flag.FlagSet) {
 		"variable $"+webURLIdent, "and used when flag \"-W\" is unspecified.",
 		"When neither is provided, Web URLs default to $"+svnURLIdent+"/"+webURLRoot+"."))
 	fmt.Fprintln(out)
-	fmt.Fprint(out, ww.wrap("The SSH command used to refresh the repository cache is defined",
+	fmt.Fprint(out, ww.wrap("The source used to refresh the repository cache is defined",
 		"with environment variable $"+svnSSHIdent, "and used when flag \"-S\" is",
-		"unspecified. The command must print one repository name per line."))
+		"unspecified. By default, the source is an SSH command that must print one",
+		"repository name per line. Other sources are selected by prefix:"))
+	fmt.Fprintln(out)
+	ww.indent = "      "
+	fmt.Fprintln(out, ww.indent+"\"ssh:command\"    ┆ SSH command (default)")
+	fmt.Fprintln(out, ww.indent+"\"dir:path\"       ┆ local directory of repositories (SVNParentPath)")
+	fmt.Fprintln(out, ww.indent+"\"file:path\"      ┆ file listing one repository name per line")
+	fmt.Fprintln(out, ww.indent+"\"https://server\" ┆ repository index of SVNListParentPath")
+	ww.indent = "  "
 	fmt.Fprintln(out)
 	fmt.Fprint(out, ww.wrap("The legacy environment variable $"+legacyAPIIdent,
 		"is no longer used for cache refresh."))
@@ -158,6 +189,133 @@ func usage(out io.Writer, set *flag.FlagSet) {
 		"\"http://server.com:3690\"."))
 	fmt.Fprintln(out)
 	fmt.Fprintln(out)
+	fmt.Fprintln(out, ww.indent+" PROFILES")
+	fmt.Fprintln(out, ww.indent+"──────────")
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("Settings for multiple servers may be defined as named profiles",
+		"in a configuration file (see CONFIGURATION below). A profile is selected",
+		"with environment variable $"+profileIdent, "or flag \"-p\", and flag \"-A\"",
+		"selects all profiles at once."))
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("The settings of a profile take precedence over environment",
+		"variables, and command-line flags take precedence over both. Each profile",
+		"uses its own repository cache, named \""+cacheName+".<profile>\" by default."))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, ww.indent+" CONFIGURATION")
+	fmt.Fprintln(out, ww.indent+"───────────────")
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("The default value of any flag may be defined in a JSON",
+		"configuration file, using the flag name as key in object \"flags\". The",
+		"user configuration file is \""+filepath.Join(configDir, configFile)+"\" in the",
+		"user's configuration directory (e.g., $XDG_CONFIG_HOME), and the project",
+		"configuration file is the nearest \""+configName+"\" found in the working",
+		"directory or any of its parents."))
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("Command-line flags take precedence over environment",
+		"variables, which take precedence over the project configuration file, which",
+		"takes precedence over the user configuration file. Use flag \"-E\" to print",
+		"the effective configuration and where each value came from."))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, ww.indent+" PATTERN DIALECTS")
+	fmt.Fprintln(out, ww.indent+"──────────────────")
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("Match and ignore patterns are regular expressions by default,",
+		"which match any part of a repository name. Flag \"-m\" selects a different",
+		"default dialect, and any single pattern may select its own dialect with",
+		"one of the following prefixes:"))
+	fmt.Fprintln(out)
+	ww.indent = "      "
+	fmt.Fprintln(out, ww.indent+"\"re:^DAPA\"     ┆ regular expression (\"regex\")")
+	fmt.Fprintln(out, ww.indent+"\"glob:DAPA_*\"  ┆ shell glob matching the entire name (\"glob\")")
+	fmt.Fprintln(out, ww.indent+"\"exact:DAPA\"   ┆ entire name (\"exact\"), also \"=DAPA\"")
+	fmt.Fprintln(out, ww.indent+"\"prefix:DAPA\"  ┆ leading part of the name (\"prefix\")")
+	ww.indent = "  "
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, ww.indent+" REPOSITORY GROUPS")
+	fmt.Fprintln(out, ww.indent+"───────────────────")
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("Named groups of repositories are stored in the repository",
+		"cache and may be used in place of any match or ignore pattern with prefix",
+		"\""+cache.GroupPrefix+"\", e.g., \""+cache.GroupPrefix+"flight\". Flag \"-N\" saves the",
+		"given match and ignore patterns as a group. Groups may also list",
+		"repositories and other groups by name (see README)."))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, ww.indent+" WORKING COPIES")
+	fmt.Fprintln(out, ww.indent+"────────────────")
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("Flag \"-C\" selects the working copies found beneath the given",
+		"directory instead of repository URLs. Each working copy is mapped to its",
+		"repository in the cache by URL (or UUID), and is selected if its repository",
+		"is selected by the given patterns. The SVN command is then run inside each",
+		"selected working copy, e.g., \"resvn -C ~/src . -- update\"."))
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("Flag \"-M\" checks out, switches, or updates the working copies",
+		"listed in a workspace manifest, for each entry whose repository is",
+		"selected by the given patterns (see README)."))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, ww.indent+" TAGS AND BRANCHES")
+	fmt.Fprintln(out, ww.indent+"───────────────────")
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("Flag \"-T\" copies the path given with flag \"-F\" to the given",
+		"path in each matched repository, e.g., \"resvn -T tags/v2.3 ^DAPA\". Before",
+		"anything is copied, every source is verified to exist and every",
+		"destination is verified not to exist. If any copy fails, the commands to",
+		"roll back the copies already made are printed. Arguments after \"--\" are",
+		"added to each copy command, e.g., \"-- -m 'Release 2.3'\"."))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, ww.indent+" BRANCH AND TAG MATRIX")
+	fmt.Fprintln(out, ww.indent+"───────────────────────")
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("Flag \"-b\" lists \"@/branches\" and \"@/tags\" of each matched",
+		"repository and prints a matrix of repositories and branch or tag names,",
+		"showing the revision each was last changed or \"✗\" if missing. Names are",
+		"selected by globs given after \"--\", e.g., \"-- tags/v2.3 'release-*'\".",
+		"Use \"-O csv\" or \"-O json\" for machine-readable output."))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, ww.indent+" MERGED LOG")
+	fmt.Fprintln(out, ww.indent+"────────────")
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("Flag \"-H\" prints the log of all matched repositories merged",
+		"into one, newest first, with the repository of each entry. Entries are",
+		"selected by author with flag \"-U\", by date with flag \"-r\" (e.g.,",
+		"\"2026-01-01..2026-03-31\"), and by message with flag \"-e\". Arguments",
+		"after \"--\" are added to each \"svn log\" command, e.g., \"-- @/trunk\"."))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, ww.indent+" CONTENT SEARCH")
+	fmt.Fprintln(out, ww.indent+"────────────────")
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("Flag \"-G\" searches the files beneath \"trunk\" of each matched",
+		"repository for lines matching a regular expression, and prints the",
+		"repository, path, last-changed revision, and line number of each match.",
+		"Search a different path by giving it after \"--\", e.g., \"-- @/branches/dev\".",
+		"Flags \"-I\" and \"-X\" include and exclude files by glob (e.g., \"*.go\" or",
+		"\"cmd/*.go\") and may be repeated. Binary files are skipped, as are",
+		"repositories without the path searched."))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, ww.indent+" SNAPSHOTS")
+	fmt.Fprintln(out, ww.indent+"───────────")
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("Flag \"-R\" records the youngest revision of each matched",
+		"repository to a snapshot file (or stdout, if \"-\"). If a path is given",
+		"after \"--\", e.g., \"@/trunk\", the last-changed revision of that path is",
+		"recorded instead. A snapshot is also a workspace manifest (see \"-M\")."))
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("Flag \"-P\" runs the SVN command only in repositories recorded in",
+		"the given snapshot, and pins each argument beginning with \"@\" to the",
+		"recorded revision with a peg revision, except arguments that already have",
+		"one and destinations (e.g., the last URL of \"copy\" or \"move\"). Use",
+		"\"{pin}\" to place the recorded revision yourself instead, e.g., \"-r {pin}\"."))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
 	fmt.Fprintln(out, ww.indent+" PARAMETER EXPANSIONS")
 	fmt.Fprintln(out, ww.indent+"──────────────────────")
 	fmt.Fprintln(out)
@@ -212,6 +370,42 @@ func usage(out io.Writer, set *flag.FlagSet) {
 	ww.indent = "  "
 	fmt.Fprintln(out)
 	fmt.Fprintln(out)
+	fmt.Fprintln(out, ww.indent+" TEMPLATES")
+	fmt.Fprintln(out, ww.indent+"───────────")
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("With flag \"-V\", each argument following \"--\" is instead",
+		"expanded as a Go template (see \"text/template\"), and placeholder",
+		"characters are left as given. The following fields and functions are",
+		"available:"))
+	fmt.Fprintln(out)
+	ww.indent = "      "
+	fmt.Fprintln(out, ww.indent+"{{.URL}}      ┆ repository URL (or Web URL, with \"-w\")")
+	fmt.Fprintln(out, ww.indent+"{{.WebURL}}   ┆ repository Web URL")
+	fmt.Fprintln(out, ww.indent+"{{.Name}}     ┆ repository path relative to server URL")
+	fmt.Fprintln(out, ww.indent+"{{.Base}}     ┆ last component of {{.Name}}")
+	fmt.Fprintln(out, ww.indent+"{{.Profile}}  ┆ profile of repository")
+	fmt.Fprintln(out, ww.indent+"{{.WC}}       ┆ working copy directory (with \"-C\")")
+	fmt.Fprintln(out, ww.indent+"{{.Pin}}      ┆ recorded revision (with \"-P\")")
+	fmt.Fprintln(out, ww.indent+"{{.Rev}}      ┆ youngest revision in cache")
+	fmt.Fprintln(out, ww.indent+"{{.Server}}   ┆ server URL prefix")
+	fmt.Fprintln(out, ww.indent+"{{.Prev}}     ┆ preceding argument, after expansion")
+	fmt.Fprintln(out, ww.indent+"{{.Index}}    ┆ position of repository in matches, from 1")
+	fmt.Fprintln(out, ww.indent+"{{.Count}}    ┆ number of matched repositories")
+	fmt.Fprintln(out, ww.indent+"lower, upper  ┆ change case, e.g., {{upper .Base}}")
+	fmt.Fprintln(out, ww.indent+"replace       ┆ {{.Name | replace \"/\" \"-\"}}")
+	fmt.Fprintln(out, ww.indent+"trimPrefix    ┆ {{.Name | trimPrefix \"teams/\"}} (and trimSuffix)")
+	fmt.Fprintln(out, ww.indent+"base, dir     ┆ last component or parent of a path")
+	fmt.Fprintln(out, ww.indent+"now, date     ┆ {{now | date \"2006-01-02\"}}")
+	ww.indent = "  "
+	fmt.Fprintln(out)
+	fmt.Fprint(out, ww.wrap("For example, the export above is written as a template:"))
+	fmt.Fprintln(out)
+	ww.indent = "      "
+	fmt.Fprint(out, ww.wrap(">", exeName(), "-V", "^DAPA", "--",
+		"export -r 123 {{.URL}}/tags/foo ./{{.Base}}/tags/foo"))
+	ww.indent = "  "
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
 	fmt.Fprintln(out, ww.indent+" SVN GLOBAL OPTIONS")
 	fmt.Fprintln(out, ww.indent+"────────────────────")
 	fmt.Fprintln(out)
@@ -247,48 +441,99 @@ func main() {
 }
 
 func runMain(args []string, getenv func(string) (string, bool), stdout io.Writer, stderr io.Writer) error {
-	var defBaseURL string
-	if url, ok := getenv(svnURLIdent); ok {
-		defBaseURL = url
-	}
-
-	var defWebBaseURL string
-	if url, ok := getenv(webURLIdent); ok {
-		defWebBaseURL = url
-	}
-
-	var defSSHCmd string
-	if cmd, ok := getenv(svnSSHIdent); ok {
-		defSSHCmd = cmd
-	}
-
 	_, legacyAPISet := getenv(legacyAPIIdent)
 
-	defSVNArgs := defaultArg
-	if arg, ok := getenv(svnARGIdent); ok {
-		defSVNArgs = svnArg{arg}
+	cfg, err := loadConfig(configPaths()...)
+	if err != nil {
+		return err
 	}
 
 	repoCache := cache.New(cacheName)
 
 	var argSVNArgs svnArg
+	var argInclude, argExclude pathGlobs
 	set := flag.NewFlagSet(exeName(), flag.ContinueOnError)
 	set.SetOutput(stderr)
+	argAllProfiles := set.Bool("A", false, "match repositories of [all] profiles")
+	argMatrix := set.Bool("b", false, "print matrix of [branches] and tags of matched repositories")
+	argRestore := set.Bool("B", false, "restore repository cache from [backup] made when last written")
 	argCaseSen := set.Bool("c", false, "use [case]-sensitive matching")
+	argWorkDir := set.String("C", "", "operate on working [copies] found beneath `dir`")
+	argFailRemoved := set.Bool("D", false, "fail if any repositories [disappeared] from server on update")
 	argDryRun := set.Bool("d", false, "print commands which would be executed ([dry-run])")
+	argPrintConfig := set.Bool("E", false, "print [effective] configuration and the source of each value")
+	argTagFrom := set.String("F", "trunk", "copy tag or branch [from] `path` in each repository (with \"-T\")")
+	argLogMessage := set.String("e", "", "select log entries by message [expression] `regex` (with \"-H\")")
 	argRepoFile := set.String("f", repoCache.FilePath, "use repository definitions from [file] `path`")
+	argSearch := set.String("G", "", "search ([grep]) files in matched repositories for `regex`")
+	argHistory := set.Bool("H", false, "print merged log ([history]) of matched repositories by date")
+	set.Var(&argInclude, "I", "[include] only files matching `glob` in search (with \"-G\")")
+	argJobs := set.Int("j", 1, "run up to `count` SVN commands concurrently ([jobs])")
 	argLogin := set.String("l", "", "deprecated: SSH auth is handled by your SSH command")
 	argAuthFile := set.String("L", "", "deprecated: SSH auth is handled by your SSH command")
+	argManifest := set.String("M", "", "check out working copies listed in workspace [manifest] `file`")
+	argGroup := set.String("N", "", "save patterns as [named] group `name` in repository cache")
+	set.Var(&argExclude, "X", "e[x]clude files matching `glob` from search (with \"-G\")")
+	argExplain := set.Bool("x", false, "e[x]plain why each repository is selected or skipped")
+	argDialect := set.String("m", cache.Regexp.String(), "use pattern [mode] `dialect` \"regex\", \"glob\", \"exact\", or \"prefix\"")
 	argMatchAny := set.Bool("o", false, "use logical-[or] matching if multiple patterns given")
+	argFormat := set.String("O", formatText, "print [output] in `format` \"text\", \"json\", or \"csv\"")
+	argPin := set.String("P", "", "[pin] URLs in SVN commands to revisions recorded in snapshot `file`")
+	argProfile := set.String("p", "", "use settings from [profile] `name`")
 	argQuiet := set.Bool("q", false, "suppress all non-essential and error messages ([quiet])")
-	argBaseURL := set.String("s", defBaseURL, "use [server] `url` to construct all URLs")
-	argWebBaseURL := set.String("W", defWebBaseURL, "use [web] `url` to construct browsing URLs")
-	argSSHCmd := set.String("S", defSSHCmd, "use [shell] `command` to update repository cache via SSH")
+	argRecord := set.String("R", "", "[record] revisions of matched repositories to snapshot `file`")
+	argTag := set.String("T", "", "create [tag] or branch `path` in each matched repository")
+	argLogDates := set.String("r", "", "select log entries in date [range] `dates` \"from..to\" (with \"-H\")")
+	argBaseURL := set.String("s", "", "use [server] `url` to construct all URLs")
+	argWebBaseURL := set.String("W", "", "use [web] `url` to construct browsing URLs")
+	argSSHCmd := set.String("S", "", "update repository cache from [shell] command or other `source`")
 	set.Var(&argSVNArgs, "a", "append each [argument] `arg` to all SVN commands")
+	argKeepGoing := set.Bool("k", false, "[keep] going after failures and summarize results")
+	argMaxAge := set.Duration("t", 0, "refresh repository cache older than [time]-to-live `ttl` (e.g., \"24h\")")
+	argLogAuthor := set.String("U", "", "select log entries by [user] `author`, comma-separated (with \"-H\")")
 	argUpdate := set.Bool("u", false, "[update] cached repository definitions from server")
+	argTemplate := set.Bool("V", false, "e[v]aluate SVN command arguments as Go templates")
 	argWebURL := set.Bool("w", false, "construct [web] URLs instead of repository URLs")
 	set.Usage = func() { usage(stderr, set) }
 
+	// the default value of each flag is defined by the following sources, in
+	// increasing order of precedence: the user configuration file, the project
+	// configuration file, and environment variables.
+	sources := map[string]string{}
+	defSVNArgs := defaultArg
+	setDefault := func(name, value, source string) error {
+		f := set.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("%s: undefined flag -%s", source, name)
+		}
+		if f.Value == &argSVNArgs {
+			defSVNArgs = svnArg(strings.Fields(value))
+		} else if err := f.Value.Set(value); err != nil {
+			return fmt.Errorf("%s: invalid value %q for flag -%s: %w", source, value, name, err)
+		}
+		f.DefValue = f.Value.String()
+		sources[name] = source
+		return nil
+	}
+	for _, doc := range cfg.docs {
+		for name, v := range doc.Flags {
+			value, err := flagValue(v)
+			if err != nil {
+				return fmt.Errorf("%s: flag -%s: %w", doc.path, name, err)
+			}
+			if err := setDefault(name, value, doc.path); err != nil {
+				return err
+			}
+		}
+	}
+	for name, ident := range envFlags {
+		if value, ok := getenv(ident); ok {
+			if err := setDefault(name, value, "$"+ident); err != nil {
+				return err
+			}
+		}
+	}
+
 	if err := set.Parse(args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return nil
@@ -296,10 +541,27 @@ func runMain(args []string, getenv func(string) (string, bool), stdout io.Writer
 		return err
 	}
 
-	if argSVNArgs == nil {
+	explicit := map[string]bool{}
+	set.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+		sources[f.Name] = "command line"
+	})
+	if !explicit["a"] {
 		argSVNArgs = defSVNArgs
 	}
 
+	if err := validFormat(*argFormat, formatText, formatJSON, formatCSV); err != nil {
+		return err
+	}
+	if *argFormat == formatCSV && !*argMatrix {
+		return fmt.Errorf("output format %q is only supported with -b", formatCSV)
+	}
+
+	dialect, err := cache.ParseDialect(*argDialect)
+	if err != nil {
+		return err
+	}
+
 	log.SetFlags(log.LstdFlags | log.Lmsgprefix)
 	log.SetPrefix("• ")
 	if *argQuiet {
@@ -327,117 +589,416 @@ func runMain(args []string, getenv func(string) (string, bool), stdout io.Writer
 		}
 	}
 
+	if *argPrintConfig {
+		return printConfig(stdout, set, sources, cfg, *argFormat)
+	}
+
 	if *argUpdate {
 		if strings.TrimSpace(*argLogin) != "" || strings.TrimSpace(*argAuthFile) != "" {
 			return fmt.Errorf("SSH cache updates use your SSH configuration; -l and -L are no longer supported with -u")
 		}
-		if strings.TrimSpace(*argSSHCmd) == "" && legacyAPISet {
-			return fmt.Errorf("%s is no longer used for cache updates; set %s or use -S", legacyAPIIdent, svnSSHIdent)
-		}
 	}
 
-	if err := repoCache.Sync(*argRepoFile, *argUpdate, *argSSHCmd); err != nil {
-		return err
+	if *argRestore && *argUpdate {
+		return fmt.Errorf("error: cannot restore (-B) and update (-u) repository cache at once")
+	}
+	if strings.TrimSpace(*argManifest) != "" && len(cmdArg) > 0 {
+		return fmt.Errorf("error: SVN command cannot be used with workspace manifest (-M)")
+	}
+
+	// newSite resolves the settings of the named profile. Flags given on the
+	// command line take precedence over the profile, which takes precedence
+	// over environment variables.
+	newSite := func(name string, prof profile) (*site, error) {
+		pick := func(flagName, value, profValue string) string {
+			if explicit[flagName] || strings.TrimSpace(profValue) == "" {
+				return value
+			}
+			return profValue
+		}
+		if strings.TrimSpace(prof.Source) != "" {
+			prof.SSH = prof.Source
+		}
+		s := &site{
+			profile:   name,
+			source:    pick("S", *argSSHCmd, prof.SSH),
+			svnArgs:   argSVNArgs,
+			cache:     repoCache,
+			cacheFile: *argRepoFile,
+		}
+		if !explicit["a"] && strings.TrimSpace(prof.Args) != "" {
+			s.svnArgs = svnArg(strings.Fields(prof.Args))
+		}
+		if name != "" {
+			// each profile has its own cache, which by default is named after
+			// the profile and located the same way as the default cache.
+			s.cache = cache.New(cacheName + "." + name)
+			s.cacheFile = pick("f", s.cache.FilePath, prof.Cache)
+			if explicit["f"] {
+				s.cacheFile = *argRepoFile
+			}
+		}
+		if *argUpdate && strings.TrimSpace(s.source) == "" && legacyAPISet {
+			return nil, fmt.Errorf("%s is no longer used for cache updates; set %s or use -S", legacyAPIIdent, svnSSHIdent)
+		}
+		src, err := cache.ParseSource(s.source)
+		if err != nil {
+			return nil, err
+		}
+		if *argRestore {
+			if err := cache.Restore(s.cacheFile); err != nil {
+				return nil, err
+			}
+			log.Printf("restored cache %s from backup\n", s.cacheFile)
+		}
+		s.cache.MaxAge = *argMaxAge
+		if err := s.cache.Sync(s.cacheFile, *argUpdate, src); err != nil {
+			return nil, err
+		}
+		s.cache.Dialect = dialect
+		if err := s.setPrefix(
+			pick("s", *argBaseURL, prof.Server),
+			pick("W", *argWebBaseURL, prof.Web),
+		); err != nil {
+			return nil, err
+		}
+		return s, nil
 	}
 
-	if strings.TrimSpace(*argBaseURL) == "" {
-		return fmt.Errorf("undefined server URL: try help (-h)")
+	profiles := []string{*argProfile}
+	if *argAllProfiles {
+		if profiles = cfg.profileNames(); len(profiles) == 0 {
+			return fmt.Errorf("no profiles defined: try help (-h)")
+		}
+	}
+	sites := make([]*site, 0, len(profiles))
+	for _, name := range profiles {
+		prof, ok := cfg.Profiles[name]
+		if name != "" && !ok {
+			return fmt.Errorf("undefined profile %q", name)
+		}
+		s, err := newSite(name, prof)
+		if err != nil {
+			return err
+		}
+		sites = append(sites, s)
 	}
 
-	*argBaseURL = strings.TrimRight(*argBaseURL, "/")
-	if strings.TrimSpace(*argWebBaseURL) != "" {
-		*argWebBaseURL = strings.TrimRight(*argWebBaseURL, "/")
+	if name := strings.TrimSpace(*argGroup); name != "" {
+		if len(patArg) == 0 {
+			return fmt.Errorf("error: no patterns to save as group %q", name)
+		}
+		group := cache.Group{}
+		for _, p := range patArg {
+			group.Match = append(group.Match, cache.Qualify(p, dialect))
+		}
+		for _, p := range ignArg {
+			group.Ignore = append(group.Ignore, cache.Qualify(p, dialect))
+		}
+		for _, s := range sites {
+			if err := s.cache.SaveGroup(name, group); err != nil {
+				return err
+			}
+			log.Printf("saved group %q in %s\n", name, s.cache.FilePath)
+		}
 	}
 
-	urlPrefix := *argBaseURL + "/" + svnURLRoot
-	if *argWebURL {
-		switch {
-		case strings.TrimSpace(*argWebBaseURL) != "":
-			urlPrefix = *argWebBaseURL
-		default:
-			urlPrefix = *argBaseURL + "/" + webURLRoot
+	var removed int
+	for _, s := range sites {
+		d := s.cache.Diff
+		if d == nil {
+			continue
+		}
+		removed += len(d.Removed)
+		if *argFormat == formatJSON {
+			if err := writeJSON(stdout, struct {
+				Profile string `json:"profile,omitempty"`
+				Cache   string `json:"cache"`
+				*cache.Diff
+			}{s.profile, s.cache.FilePath, d}); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, repo := range d.Added {
+			log.Printf("added repository: %s\n", repo)
+		}
+		for _, repo := range d.Removed {
+			log.Printf("removed repository: %s\n", repo)
 		}
+		log.Printf("%d added, %d removed in %s\n", len(d.Added), len(d.Removed), s.cache.FilePath)
+	}
+	if *argFailRemoved && removed > 0 {
+		return fmt.Errorf("error: %d repositories removed from server", removed)
 	}
 
-	listMatch := func(match []string) {
-		for _, repo := range match {
-			fmt.Fprintf(stdout, "%s/%s%s", urlPrefix, repo, newline)
+	listMatch := func(match []target) error {
+		for _, t := range match {
+			if *argFormat == formatJSON {
+				if err := writeJSON(stdout, record{
+					Profile:     t.site.profile,
+					Name:        t.repo,
+					URL:         t.site.url(t.repo, false),
+					WebURL:      t.site.url(t.repo, true),
+					WorkingCopy: t.wc,
+				}); err != nil {
+					return err
+				}
+				continue
+			}
+			if t.wc != "" {
+				fmt.Fprintf(stdout, "%s%s", t.wc, newline)
+				continue
+			}
+			fmt.Fprintf(stdout, "%s%s", t.site.url(t.repo, *argWebURL), newline)
 		}
+		return nil
 	}
 
-	runMatch := func(match []string) error {
-		for _, repo := range match {
-			url := fmt.Sprintf("%s/%s", urlPrefix, repo)
+	run := &runner{
+		workers:   *argJobs,
+		dryRun:    *argDryRun,
+		keepGoing: *argKeepGoing,
+		format:    *argFormat,
+		stdout:    stdout,
+		stderr:    stderr,
+	}
+
+	// pin is the revision of each repository recorded in a snapshot (-P). If
+	// the command does not place the revision itself, the arguments selected by
+	// pegArgs are pinned to it with a peg revision. Templates (-V) always place
+	// the revision themselves.
+	var pin map[target]revision
+	var peg []bool
+	if !*argTemplate && !slices.ContainsFunc(cmdArg, func(arg string) bool {
+		// only an unescaped "{pin}" expands to the revision.
+		return expand(arg, "", "", "", map[string]string{"pin": "0"}) != expand(arg, "", "", "", nil)
+	}) {
+		peg = pegArgs(cmdArg)
+	}
 
-			gn := len(argSVNArgs)
+	runMatch := func(match []target) error {
+		var tmpl []*template.Template
+		if *argTemplate {
+			var err error
+			if tmpl, err = parseTemplates(cmdArg); err != nil {
+				return err
+			}
+		}
+		jobs := make([]*job, len(match))
+		for n, t := range match {
+			url := t.site.url(t.repo, *argWebURL)
+			vars := t.vars(n, len(match))
+			rev, pinned := pin[target{site: t.site, repo: t.repo}]
+			if pinned {
+				vars["pin"] = string(rev)
+			}
+
+			gn := len(t.site.svnArgs)
 			expArg := make([]string, gn+len(cmdArg))
-			copy(expArg, argSVNArgs)
+			copy(expArg, t.site.svnArgs)
 			for i, s := range cmdArg {
 				prec := ""
 				if i > 0 {
 					prec = expArg[gn+i-1]
 				}
-				expArg[gn+i] = expand(s, url, repo, prec)
-			}
-
-			var cli strings.Builder
-			for i, s := range expArg {
-				if i > 0 {
-					cli.WriteRune(' ')
+				if tmpl == nil {
+					expArg[gn+i] = expand(s, url, t.repo, prec, vars)
+					continue
+				}
+				data := argData{
+					Profile: t.site.profile,
+					Name:    t.repo,
+					Base:    path.Base(t.repo),
+					URL:     url,
+					Server:  t.site.svnPrefix,
+					WebURL:  t.site.url(t.repo, true),
+					WC:      t.wc,
+					Pin:     string(rev),
+					Rev:     vars["rev"],
+					Prev:    prec,
+					Index:   n + 1,
+					Count:   len(match),
 				}
-				if strings.ContainsAny(s, " \t\n$&|<>;`~#{}[]*?!") {
-					cli.WriteString("'")
-					cli.WriteString(s)
-					cli.WriteString("'")
-				} else {
-					cli.WriteString(s)
+				var err error
+				if expArg[gn+i], err = data.execute(tmpl[i]); err != nil {
+					return err
 				}
 			}
-			log.Println("» svn " + cli.String())
-			if !*argDryRun {
-				if err := runSVN(expArg...); err != nil {
-					return fmt.Errorf("error: %w", err)
+			for i, pegged := range peg {
+				if pinned && pegged {
+					expArg[gn+i] += "@" + string(rev)
 				}
 			}
+			jobs[n] = newJob(t.repo, expArg)
+			jobs[n].profile = t.site.profile
+			jobs[n].url = t.site.url(t.repo, false)
+			jobs[n].webURL = t.site.url(t.repo, true)
+			jobs[n].dir = t.wc
+			jobs[n].wc = t.wc
 		}
-		return nil
+		return run.run(jobs)
 	}
 
-	if len(patArg) == 0 {
-		if len(cmdArg) == 0 {
-			for _, repo := range repoCache.List {
-				fmt.Fprintf(stdout, "%s/%s%s", urlPrefix, repo, newline)
+	// explainRepos returns a trace of the selection of each repository of s by
+	// the given patterns.
+	explainRepos := func(s *site) ([]cache.Trace, error) {
+		if len(patArg) == 0 {
+			trace := make([]cache.Trace, len(s.cache.List))
+			for i, repo := range s.cache.List {
+				trace[i] = cache.Trace{Repo: repo, Selected: true}
 			}
+			return trace, nil
 		}
-		return nil
+		pattern := patArg
+		if *argMatchAny {
+			// with logical-or matching, invalid patterns are skipped rather than
+			// rejecting the entire selection.
+			pattern = nil
+			for _, arg := range patArg {
+				if _, err := s.cache.Explain([]string{arg}, nil, !*argCaseSen, true); err != nil {
+					log.Printf("warning: skipping invalid expression: %s: %v\n", arg, err)
+					continue
+				}
+				pattern = append(pattern, arg)
+			}
+		}
+		trace, err := s.cache.Explain(pattern, ignArg, !*argCaseSen, *argMatchAny)
+		if err != nil {
+			return nil, fmt.Errorf("error: invalid expression(s): [ %s ]: %w", strings.Join(patArg, ", "), err)
+		}
+		return trace, nil
 	}
 
-	if *argMatchAny {
-		for _, arg := range patArg {
-			match, err := repoCache.Match([]string{arg}, ignArg, !*argCaseSen)
+	if *argExplain {
+		for _, s := range sites {
+			trace, err := explainRepos(s)
 			if err != nil {
-				log.Println("warning: skipping invalid expression:", arg)
-				continue
+				return err
 			}
-			if len(cmdArg) == 0 {
-				listMatch(match)
-			} else if err := runMatch(match); err != nil {
+			if err := printTrace(stdout, s.profile, trace, *argFormat); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
 
-	match, err := repoCache.Match(patArg, ignArg, !*argCaseSen)
-	if err != nil {
-		return fmt.Errorf("error: invalid expression(s): [ %s ]", strings.Join(patArg, ", "))
+	if len(patArg) == 0 && len(cmdArg) > 0 && *argRecord == "" && *argTag == "" && *argSearch == "" && !*argHistory && !*argMatrix {
+		return nil
 	}
-	if len(match) == 0 {
+
+	var match []target
+	for _, s := range sites {
+		trace, err := explainRepos(s)
+		if err != nil {
+			return err
+		}
+		for _, t := range trace {
+			if t.Selected {
+				match = append(match, target{site: s, repo: t.Repo})
+			}
+		}
+	}
+	if len(patArg) > 0 && len(match) == 0 && !*argMatchAny {
 		return fmt.Errorf("error: no repository found matching expression(s): [ %s ]", strings.Join(patArg, ", "))
 	}
+	if dir := strings.TrimSpace(*argWorkDir); dir != "" {
+		var err error
+		if match, err = workingCopies(dir, argSVNArgs, sites, match); err != nil {
+			return err
+		}
+		if len(patArg) > 0 && len(match) == 0 && !*argMatchAny {
+			return fmt.Errorf("error: no working copy in %s found matching expression(s): [ %s ]", dir, strings.Join(patArg, ", "))
+		}
+	}
+	if *argHistory {
+		filter := logFilter{}
+		for _, author := range strings.Split(*argLogAuthor, ",") {
+			if author = strings.TrimSpace(author); author != "" {
+				filter.authors = append(filter.authors, author)
+			}
+		}
+		var err error
+		if filter.from, filter.to, err = parseDateRange(*argLogDates); err != nil {
+			return err
+		}
+		if *argLogMessage != "" {
+			expr := *argLogMessage
+			if !*argCaseSen {
+				expr = "(?i)" + expr
+			}
+			if filter.message, err = regexp.Compile(expr); err != nil {
+				return fmt.Errorf("error: invalid expression: %s: %w", *argLogMessage, err)
+			}
+		}
+		entries, err := history(match, cmdArg, filter, *argJobs)
+		if err != nil {
+			return err
+		}
+		return printHistory(stdout, entries, *argFormat)
+	}
+	if *argMatrix {
+		var globs pathGlobs
+		for _, a := range cmdArg {
+			if err := globs.Set(a); err != nil {
+				return fmt.Errorf("error: %w", err)
+			}
+		}
+		names, rows, err := matrix(match, globs, *argJobs)
+		if err != nil {
+			return err
+		}
+		return printMatrix(stdout, match, names, rows, *argFormat)
+	}
+	if *argSearch != "" {
+		if len(cmdArg) > 1 {
+			return fmt.Errorf("error: search (-G) accepts at most one path argument: [ %s ]", strings.Join(cmdArg, ", "))
+		}
+		expr := *argSearch
+		if !*argCaseSen {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("error: invalid expression: %s: %w", *argSearch, err)
+		}
+		root := "trunk"
+		if len(cmdArg) > 0 {
+			root = cmdArg[0]
+		}
+		found, err := search(match, root, re, argInclude, argExclude, *argJobs)
+		if err != nil {
+			return err
+		}
+		return printSearch(stdout, found, *argFormat)
+	}
+	if dst := strings.TrimSpace(*argTag); dst != "" {
+		if len(patArg) == 0 {
+			return fmt.Errorf("error: no patterns to select repositories to tag: try help (-h)")
+		}
+		return tag(match, *argTagFrom, dst, cmdArg, run)
+	}
+	if file := strings.TrimSpace(*argRecord); file != "" {
+		if len(cmdArg) > 1 {
+			return fmt.Errorf("error: snapshot (-R) accepts at most one path argument: [ %s ]", strings.Join(cmdArg, ", "))
+		}
+		return writeSnapshot(file, stdout, match, strings.Join(cmdArg, ""))
+	}
+	if file := strings.TrimSpace(*argPin); file != "" {
+		var err error
+		if match, pin, err = pins(file, sites, match); err != nil {
+			return err
+		}
+	}
+	if file := strings.TrimSpace(*argManifest); file != "" {
+		ws, err := loadWorkspace(file)
+		if err != nil {
+			return err
+		}
+		return materialize(ws, sites, match, run)
+	}
 	if len(cmdArg) == 0 {
-		listMatch(match)
-		return nil
+		return listMatch(match)
 	}
 	return runMatch(match)
 }
@@ -466,28 +1027,86 @@ func trimTrailingRune(s string, r rune, trim0 bool) string {
 	}
 }
 
-func expand(str string, url, base, prec string) string {
-	for len(str) > 0 && str[0] == '@' {
-		str = url + str[1:]
-	}
+// rawPrefix marks an argument that is passed to each SVN command verbatim,
+// without the marker and without expanding any parameters.
+const rawPrefix = "="
 
-	prec = trimTrailingRune(prec, '/', false)
-	bn := filepath.Base(prec)
-	pn := filepath.Base(filepath.Dir(prec))
+// isURLArg reports whether argument str begins with the "@" parameter.
+func isURLArg(str string) bool {
+	return strings.HasPrefix(str, "@") && !strings.HasPrefix(str, "@@")
+}
 
-	str = strings.ReplaceAll(str, "^", base)
+// expand returns argument str with each parameter replaced by its value for
+// repository repo at url, given the expansion of the preceding argument prec.
+// Parameters are expanded in a single pass, so the value of one parameter is
+// never subject to further expansion. A doubled parameter character (e.g.,
+// "%%", "{{", or a leading "@@") is replaced by that character, and an
+// argument beginning with rawPrefix is returned without it and otherwise
+// unchanged.
+//
+// Named parameters are replaced by their values in vars. A named parameter
+// that has no value in vars is left unexpanded.
+func expand(str string, url, repo, prec string, vars map[string]string) string {
+	if raw, ok := strings.CutPrefix(str, rawPrefix); ok {
+		return raw
+	}
+
+	var sb strings.Builder
+	switch {
+	case isURLArg(str):
+		sb.WriteString(url)
+		str = str[1:]
+	case strings.HasPrefix(str, "@@"):
+		sb.WriteByte('@')
+		str = str[2:]
+	}
 
-	if root, ok := strings.CutSuffix(url, base); ok {
+	prec = trimTrailingRune(prec, '/', false)
+	value := map[byte]string{
+		// the repository path may have several components, of which "^" is
+		// only the last.
+		'^': path.Base(repo),
+		'&': prec,
+		'$': filepath.Base(prec),
+		'!': filepath.Base(filepath.Dir(prec)),
+	}
+	if root, ok := strings.CutSuffix(url, repo); ok {
 		if pr, ok := strings.CutPrefix(prec, root); ok {
-			str = strings.ReplaceAll(str, "%", pr)
+			value['%'] = pr
 		}
 	}
 
-	str = strings.ReplaceAll(str, "&", prec)
-	str = strings.ReplaceAll(str, "$", bn)
-	str = strings.ReplaceAll(str, "!", pn)
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		switch c {
+		case '^', '%', '&', '$', '!':
+			if i+1 < len(str) && str[i+1] == c {
+				sb.WriteByte(c)
+				i++
+			} else if v, ok := value[c]; ok {
+				sb.WriteString(v)
+			} else {
+				sb.WriteByte(c)
+			}
+			continue
+		case '{', '}':
+			if i+1 < len(str) && str[i+1] == c {
+				sb.WriteByte(c)
+				i++
+				continue
+			}
+			if j := strings.IndexByte(str[i:], '}'); c == '{' && j > 0 {
+				if v, ok := vars[str[i+1:i+j]]; ok {
+					sb.WriteString(v)
+					i += j
+					continue
+				}
+			}
+		}
+		sb.WriteByte(c)
+	}
 
-	return str
+	return sb.String()
 }
 
 func nonEmpty(arg ...string) []string {
@@ -500,32 +1119,39 @@ func nonEmpty(arg ...string) []string {
 	return result
 }
 
+// scribe is an io.Writer that retains a copy of everything written through it.
+//
+// The buffer is not embedded so that bytes.Buffer.ReadFrom is not promoted,
+// which would let io.Copy bypass the underlying Writer entirely.
 type scribe struct {
 	io.Writer
-	bytes.Buffer
+	buf bytes.Buffer
 }
 
 func newScribe(w io.Writer) *scribe { return &scribe{Writer: w} }
 
 func (s *scribe) Write(b []byte) (int, error) {
-	s.Buffer.Write(b)
+	s.buf.Write(b)
 	return s.Writer.Write(b)
 }
 
-func runSVN(arg ...string) error {
-	stderr := newScribe(os.Stderr)
+func (s *scribe) Len() int       { return s.buf.Len() }
+func (s *scribe) String() string { return s.buf.String() }
+
+// runSVN runs svn with the given arguments in directory dir, or in the current
+// directory if dir is empty.
+func runSVN(dir string, stdout, stderr io.Writer, arg ...string) error {
+	scr := newScribe(stderr)
 	cmd := exec.Command("svn", nonEmpty(arg...)...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = stderr
+	cmd.Dir = dir
+	cmd.Stdout = stdout
+	cmd.Stderr = scr
 	cmd.Env = nil
 	err := cmd.Run()
-	if stderr.Len() > 0 {
-		if err != nil {
-			return fmt.Errorf("%w\r\n%s", err, strings.TrimSpace(stderr.String()))
-		}
-		return errors.New(strings.TrimSpace(stderr.String()))
+	if err != nil || scr.Len() > 0 {
+		return &svnError{Err: err, Stderr: strings.TrimSpace(scr.String())}
 	}
-	return err
+	return nil
 }
 
 type wordWrap struct {
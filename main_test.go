@@ -2,12 +2,29 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+
+	"github.com/ardnew/resvn/cache"
 )
 
+func TestMain(m *testing.M) {
+	// isolate tests from the user configuration file of whoever runs them.
+	dir, err := os.MkdirTemp("", "resvn-config")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestRunUpdateViaSSH(t *testing.T) {
 	tempDir := t.TempDir()
 	cacheFile := filepath.Join(tempDir, "repos.txt")
@@ -38,9 +55,19 @@ func TestRunUpdateViaSSH(t *testing.T) {
 	if err != nil {
 		t.Fatalf("ReadFile(%q): %v", cacheFile, err)
 	}
-	wantCache := "alpha\nbeta\nzebra\n"
-	if string(data) != wantCache {
-		t.Fatalf("cache contents=%q want %q", string(data), wantCache)
+	var doc struct {
+		Version int
+		Repos   []struct{ Name string }
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Unmarshal(%q): %v", data, err)
+	}
+	var names []string
+	for _, repo := range doc.Repos {
+		names = append(names, repo.Name)
+	}
+	if doc.Version != cache.Version || strings.Join(names, " ") != "alpha beta zebra" {
+		t.Fatalf("cache contents=%q want version %d with alpha beta zebra", data, cache.Version)
 	}
 }
 
@@ -140,6 +167,1060 @@ func TestRunWebURLsFallBackToLegacyViewVCPath(t *testing.T) {
 	}
 }
 
+func TestRunParallelKeepsOutputOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("alpha\nbeta\ngamma\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+	fakeSVN(t, `case "$3" in *alpha) sleep 0.2 ;; esac
+echo "out $3"`)
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-j", "3", ".", "--", "info", "@"},
+		envLookup(nil),
+		stdout,
+		stderr,
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v\nstderr=%s", err, stderr.String())
+	}
+
+	want := strings.Join([]string{
+		"out http://svn.example/svn/alpha",
+		"out http://svn.example/svn/beta",
+		"out http://svn.example/svn/gamma",
+	}, "\n") + "\n"
+	if stdout.String() != want {
+		t.Fatalf("stdout=%q want %q", stdout.String(), want)
+	}
+}
+
+func TestRunNestedRepositories(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("teams/avionics/fcs\nteams/ground\nfcs\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+	fakeSVN(t, `shift; echo "$@"`)
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "^teams/.*/fcs$", "--",
+			"export", "@/trunk", "%", "./{repo}/^"},
+		envLookup(nil),
+		stdout,
+		stderr,
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v\nstderr=%s", err, stderr.String())
+	}
+
+	want := "export http://svn.example/svn/teams/avionics/fcs/trunk " +
+		"teams/avionics/fcs/trunk ./teams/avionics/fcs/fcs\n"
+	if stdout.String() != want {
+		t.Fatalf("stdout=%q want %q", stdout.String(), want)
+	}
+}
+
+func TestRunWorkingCopies(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.json")
+	data := `{"version": 1, "repos": [{"name": "alpha"}, {"name": "beta", "uuid": "beta-uuid"}, {"name": "gamma"}]}`
+	if err := os.WriteFile(cacheFile, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+	src := filepath.Join(tempDir, "src")
+	for _, wc := range []string{"a", "b/trunk", "b/trunk/sub", "c", "other", ".hidden"} {
+		if err := os.MkdirAll(filepath.Join(src, wc, ".svn"), 0o700); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(src, "plain"), 0o700); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	// working copies a, b/trunk, c, and other are checked out from alpha, beta
+	// (using another server URL), gamma, and an unknown repository.
+	fakeSVN(t, `if [ "$2" = info ]; then
+  shift 4
+  echo '<?xml version="1.0" encoding="UTF-8"?><info>'
+  for wc in "$@"; do
+    case "$wc" in
+      */a) root=http://svn.example/svn/alpha uuid=alpha-uuid ;;
+      */b/trunk) root=https://mirror.example/beta uuid=beta-uuid ;;
+      */c) root=http://svn.example/svn/gamma uuid=gamma-uuid ;;
+      *) root=http://svn.example/svn/other uuid=other-uuid ;;
+    esac
+    echo "<entry kind=\"dir\" path=\"$wc\" revision=\"1\"><url>$root/trunk</url>"
+    echo "<repository><root>$root</root><uuid>$uuid</uuid></repository></entry>"
+  done
+  echo '</info>'
+  exit 0
+fi
+shift; echo "$(basename "$PWD") $@"`)
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-C", src, "^(alpha|beta)$", "--",
+			"update", "{wc}", "^"},
+		envLookup(nil),
+		stdout,
+		stderr,
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v\nstderr=%s", err, stderr.String())
+	}
+
+	want := "a update " + filepath.Join(src, "a") + " alpha\n" +
+		"trunk update " + filepath.Join(src, "b", "trunk") + " beta\n"
+	if stdout.String() != want {
+		t.Fatalf("stdout=%q want %q", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "skipping working copy "+filepath.Join(src, "other")) {
+		t.Fatalf("stderr=%q, want warning about unknown working copy", stderr.String())
+	}
+
+	// working copies are pinned to the revisions recorded in a snapshot.
+	snap := filepath.Join(tempDir, "snap.json")
+	if err := os.WriteFile(snap, []byte(`{"entries": [{"repo": "alpha", "revision": 7}]}`), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", snap, err)
+	}
+	stdout.Reset()
+	stderr.Reset()
+	err = runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-C", src, "-P", snap, "^(alpha|beta)$", "--",
+			"update", "-r", "{pin}", "{wc}"},
+		envLookup(nil),
+		stdout,
+		stderr,
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v\nstderr=%s", err, stderr.String())
+	}
+	if want := "a update -r 7 " + filepath.Join(src, "a") + "\n"; stdout.String() != want {
+		t.Fatalf("stdout=%q want %q", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "skipping beta: no revision recorded") {
+		t.Fatalf("stderr=%q, want warning about beta", stderr.String())
+	}
+}
+
+func TestRunWorkspaceManifest(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("alpha\nbeta\ngamma\ndelta\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+	ws := filepath.Join(tempDir, "ws")
+	manifest := filepath.Join(ws, "manifest.json")
+	writeFile := func(path, data string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("WriteFile(%q): %v", path, err)
+		}
+	}
+	writeFile(manifest, `{"entries": [
+  {"repo": "alpha", "path": "trunk"},
+  {"repo": "beta", "path": "trunk", "revision": 5},
+  {"repo": "gamma", "path": "branches/x", "dir": "g"},
+  {"repo": "delta", "path": "trunk", "dir": "d"}
+]}`)
+	// the fake working copies record their URL and revision in .svn/state, and
+	// the youngest revision of every repository is 12.
+	writeFile(filepath.Join(ws, "beta", ".svn", "state"), "http://svn.example/svn/beta/trunk 5\n")
+	writeFile(filepath.Join(ws, "g", ".svn", "state"), "http://svn.example/svn/gamma/trunk 12\n")
+	writeFile(filepath.Join(ws, "d", ".svn", "state"), "http://svn.example/svn/delta/trunk 3\n")
+	fakeSVN(t, `cmd=$2; shift 2; rev=12
+case "$cmd" in
+info)
+  shift; if [ "$1" = -r ]; then shift 2; fi; shift
+  echo '<?xml version="1.0" encoding="UTF-8"?><info>'
+  for wc in "$@"; do
+    url=$wc; r=12
+    if [ -f "$wc/.svn/state" ]; then read url r < "$wc/.svn/state"; fi
+    echo "<entry kind=\"dir\" path=\"$wc\" revision=\"$r\"><url>$url</url></entry>"
+  done
+  echo '</info>' ;;
+*)
+  if [ "$1" = -r ]; then rev=$2; shift 2; fi; shift
+  if [ "$cmd" = update ]; then dir=$1; read url r < "$dir/.svn/state"; else url=$1; dir=$2; fi
+  mkdir -p "$dir/.svn"; echo "$url $rev" > "$dir/.svn/state"
+  echo "$cmd $(basename "$dir")" ;;
+esac`)
+
+	for _, want := range []struct{ stdout, summary string }{
+		{"checkout alpha\nswitch g\nupdate d\n", "1 created, 1 switched, 1 updated, 1 current, 0 failed, 0 skipped"},
+		{"", "0 created, 0 switched, 0 updated, 4 current, 0 failed, 0 skipped"},
+	} {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		err := runMain(
+			[]string{"-f", cacheFile, "-s", "http://svn.example", "-M", manifest},
+			envLookup(nil),
+			stdout,
+			stderr,
+		)
+		if err != nil {
+			t.Fatalf("runMain returned error: %v\nstderr=%s", err, stderr.String())
+		}
+		if stdout.String() != want.stdout {
+			t.Fatalf("stdout=%q want %q", stdout.String(), want.stdout)
+		}
+		if !strings.Contains(stderr.String(), want.summary) {
+			t.Fatalf("stderr=%q, want summary %q", stderr.String(), want.summary)
+		}
+	}
+
+	// every record names the working copy of its entry, whatever the action.
+	writeFile(filepath.Join(ws, "d", ".svn", "state"), "http://svn.example/svn/delta/trunk 3\n")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-M", manifest, "-O", "json", "^(beta|delta)$"},
+		envLookup(nil),
+		stdout,
+		stderr,
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v\nstderr=%s", err, stderr.String())
+	}
+	got := map[string]string{}
+	dec := json.NewDecoder(stdout)
+	for dec.More() {
+		var rec struct {
+			WorkingCopy string `json:"working_copy"`
+			Action      string `json:"action"`
+		}
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("invalid JSON output: %v", err)
+		}
+		got[rec.Action] = rec.WorkingCopy
+	}
+	if got["current"] != filepath.Join(ws, "beta") || got["update"] != filepath.Join(ws, "d") {
+		t.Fatalf("got working copies by action %v, want beta current and d updated", got)
+	}
+}
+
+func TestRunSnapshotAndReplay(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("alpha\nbeta\ngamma\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+	// the youngest revision of each repository is 20, and the last-changed
+	// revision of each path is the length of its URL.
+	fakeSVN(t, `if [ "$2" = info ]; then
+  shift 4
+  echo '<?xml version="1.0" encoding="UTF-8"?><info>'
+  for url in "$@"; do
+    echo "<entry kind=\"dir\" path=\"x\" revision=\"20\"><url>$url</url><commit revision=\"${#url}\"/></entry>"
+  done
+  echo '</info>'
+  exit 0
+fi
+shift; echo "$@"`)
+
+	snap := filepath.Join(tempDir, "release.json")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-R", snap, "^(alpha|beta)$", "--", "@/trunk"},
+		envLookup(nil),
+		stdout,
+		stderr,
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v\nstderr=%s", err, stderr.String())
+	}
+	data, err := os.ReadFile(snap)
+	if err != nil {
+		t.Fatalf("ReadFile(%q): %v", snap, err)
+	}
+	var ws struct {
+		Entries []struct {
+			Repo     string `json:"repo"`
+			Path     string `json:"path"`
+			Revision int64  `json:"revision"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(data, &ws); err != nil {
+		t.Fatalf("invalid snapshot: %v\n%s", err, data)
+	}
+	if len(ws.Entries) != 2 || ws.Entries[0].Repo != "alpha" || ws.Entries[0].Path != "trunk" ||
+		ws.Entries[0].Revision != int64(len("http://svn.example/svn/alpha/trunk")) {
+		t.Fatalf("got snapshot %s", data)
+	}
+
+	for _, tc := range []struct {
+		cmd  []string
+		want string
+	}{
+		{[]string{"export", "@/trunk", "./^"},
+			"export http://svn.example/svn/alpha/trunk@34 ./alpha\n" +
+				"export http://svn.example/svn/beta/trunk@33 ./beta\n"},
+		{[]string{"log", "-r", "{pin}:HEAD", "@"},
+			"log -r 34:HEAD http://svn.example/svn/alpha\n" +
+				"log -r 33:HEAD http://svn.example/svn/beta\n"},
+		// an escaped "{{pin}}" does not place the revision.
+		{[]string{"export", "-m", "see {{pin}}", "@/trunk"},
+			"export -m see {pin} http://svn.example/svn/alpha/trunk@34\n" +
+				"export -m see {pin} http://svn.example/svn/beta/trunk@33\n"},
+		// destinations and URLs with a peg revision are not pinned.
+		{[]string{"copy", "-m", "Release", "@/trunk", "@/tags/rel"},
+			"copy -m Release http://svn.example/svn/alpha/trunk@34 http://svn.example/svn/alpha/tags/rel\n" +
+				"copy -m Release http://svn.example/svn/beta/trunk@33 http://svn.example/svn/beta/tags/rel\n"},
+		{[]string{"diff", "@/trunk@HEAD", "@/trunk"},
+			"diff http://svn.example/svn/alpha/trunk@HEAD http://svn.example/svn/alpha/trunk@34\n" +
+				"diff http://svn.example/svn/beta/trunk@HEAD http://svn.example/svn/beta/trunk@33\n"},
+	} {
+		stdout.Reset()
+		stderr.Reset()
+		err := runMain(
+			append([]string{"-f", cacheFile, "-s", "http://svn.example", "-P", snap, ".", "--"}, tc.cmd...),
+			envLookup(nil),
+			stdout,
+			stderr,
+		)
+		if err != nil {
+			t.Fatalf("runMain returned error: %v\nstderr=%s", err, stderr.String())
+		}
+		if stdout.String() != tc.want {
+			t.Fatalf("stdout=%q want %q", stdout.String(), tc.want)
+		}
+		if !strings.Contains(stderr.String(), "skipping gamma") {
+			t.Fatalf("stderr=%q, want warning about gamma", stderr.String())
+		}
+	}
+}
+
+func TestRunTag(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("alpha\nbeta\ngamma\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+	// the URLs that exist are listed in file "exist", and copies in beta fail.
+	exist := filepath.Join(tempDir, "exist")
+	t.Setenv("EXIST", exist)
+	fakeSVN(t, `case "$2" in
+info)
+  shift 4
+  echo '<?xml version="1.0" encoding="UTF-8"?><info>'
+  for url in "$@"; do
+    if grep -qx "$url" "$EXIST"; then
+      echo "<entry kind=\"dir\" path=\"x\" revision=\"1\"><url>$url</url></entry>"
+    else
+      echo "svn: warning: W170000: URL '$url' non-existent in revision 1" 1>&2
+    fi
+  done
+  echo '</info>'
+  exit 1 ;;
+copy)
+  case "$*" in *beta*) echo "svn: E160013: copy failed" 1>&2; exit 1 ;; esac
+  shift; echo "$@" ;;
+esac`)
+
+	writeExist := func(urls ...string) {
+		t.Helper()
+		if err := os.WriteFile(exist, []byte(strings.Join(urls, "\n")+"\n"), 0o600); err != nil {
+			t.Fatalf("WriteFile(%q): %v", exist, err)
+		}
+	}
+	var urls []string
+	for _, repo := range []string{"alpha", "beta", "gamma"} {
+		urls = append(urls, "http://svn.example/svn/"+repo+"/trunk", "http://svn.example/svn/"+repo+"/tags")
+	}
+
+	// validation fails in beta, which already has the tag.
+	writeExist(append(urls, "http://svn.example/svn/beta/tags/v1")...)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	args := []string{"-f", cacheFile, "-s", "http://svn.example", "-T", "tags/v1", "-k", ".", "--", "-m", "Release 1"}
+	err := runMain(args, envLookup(nil), stdout, stderr)
+	if err == nil || !strings.Contains(err.Error(), "validation failed in 1 of 3") {
+		t.Fatalf("got err=%v, want validation failure", err)
+	}
+	if stdout.Len() != 0 || !strings.Contains(stderr.String(), "destination already exists: http://svn.example/svn/beta/tags/v1") {
+		t.Fatalf("stdout=%q stderr=%q, want no copies and a reason", stdout.String(), stderr.String())
+	}
+
+	// the copy fails in beta after validation, and the attached message is
+	// not followed by a default message.
+	writeExist(urls...)
+	stdout.Reset()
+	stderr.Reset()
+	args = append(args[:len(args)-2], "-mRelease 1")
+	err = runMain(args, envLookup(nil), stdout, stderr)
+	if err == nil {
+		t.Fatal("runMain returned nil error for failed copy")
+	}
+	want := "copy -mRelease 1 -- http://svn.example/svn/alpha/trunk http://svn.example/svn/alpha/tags/v1\n" +
+		"copy -mRelease 1 -- http://svn.example/svn/gamma/trunk http://svn.example/svn/gamma/tags/v1\n"
+	if stdout.String() != want {
+		t.Fatalf("stdout=%q want %q", stdout.String(), want)
+	}
+	for _, line := range []string{
+		"svn --force-interactive delete -m 'Roll back v1' -- http://svn.example/svn/alpha/tags/v1",
+		"svn --force-interactive delete -m 'Roll back v1' -- http://svn.example/svn/gamma/tags/v1",
+		"not copied: beta (failed)",
+	} {
+		if !strings.Contains(stderr.String(), line) {
+			t.Fatalf("stderr=%q, want %q", stderr.String(), line)
+		}
+	}
+}
+
+func TestRunHistory(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("alpha\nbeta\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+	fakeSVN(t, `for url; do :; done
+entry() { echo "<logentry revision=\"$1\"><author>$2</author><date>$3T12:00:00.000000Z</date><msg>$4</msg></logentry>"; }
+echo '<?xml version="1.0" encoding="UTF-8"?><log>'
+case "$url" in
+*alpha) entry 3 ann 2026-03-01 "Fix FOO-12"; entry 2 bob 2026-01-15 "Add bar"; entry 1 ann 2025-12-01 "Import" ;;
+*beta) entry 7 bob 2026-02-01 "Fix foo-34"; entry 6 cat 2026-01-20 "Tweak" ;;
+esac
+echo '</log>'`)
+
+	for _, tc := range []struct {
+		flags []string
+		want  string // "repo@rev" of selected entries
+	}{
+		{nil, "alpha@3 beta@7 beta@6 alpha@2 alpha@1"},
+		{[]string{"-U", "ann,cat"}, "alpha@3 beta@6 alpha@1"},
+		{[]string{"-r", "2026-01-15..2026-02-01"}, "beta@7 beta@6 alpha@2"},
+		{[]string{"-r", "2026-01-16.."}, "alpha@3 beta@7 beta@6"},
+		{[]string{"-e", `^fix foo-\d+`}, "alpha@3 beta@7"},
+		{[]string{"-c", "-e", "FOO"}, "alpha@3"},
+	} {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		args := append([]string{"-f", cacheFile, "-s", "http://svn.example", "-H", "-j", "2", "-O", "json"}, tc.flags...)
+		if err := runMain(args, envLookup(nil), stdout, stderr); err != nil {
+			t.Fatalf("runMain(%q) returned error: %v\nstderr=%s", tc.flags, err, stderr.String())
+		}
+		var got []string
+		dec := json.NewDecoder(stdout)
+		for dec.More() {
+			var e struct {
+				Name     string `json:"name"`
+				Revision int64  `json:"revision"`
+			}
+			if err := dec.Decode(&e); err != nil {
+				t.Fatalf("invalid JSON output: %v", err)
+			}
+			got = append(got, fmt.Sprintf("%s@%d", e.Name, e.Revision))
+		}
+		if strings.Join(got, " ") != tc.want {
+			t.Fatalf("runMain(%q) selected %v, want [%s]", tc.flags, got, tc.want)
+		}
+	}
+}
+
+func TestRunSearch(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("alpha\nbeta\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+	// the youngest revisions of alpha and beta are 20 and 30, and files exist
+	// only at those revisions: branches/dev of beta was copied after cfg.go
+	// was last changed.
+	fakeSVN(t, `for url; do :; done
+entry() { echo "<entry kind=\"$1\"><name>$2</name><size>10</size><commit revision=\"$3\"></commit></entry>"; }
+case "$2:$url" in
+info:*alpha/trunk) echo "<info><entry kind=\"dir\" path=\"trunk\" revision=\"20\"><url>$url</url></entry></info>" ;;
+info:*beta/branches/dev) echo "<info><entry kind=\"dir\" path=\"dev\" revision=\"30\"><url>$url</url></entry></info>" ;;
+info:*beta/trunk) echo "svn: E170000: URL '$url' non-existent in revision 30" >&2; exit 1 ;;
+list:*alpha/trunk@20)
+	echo '<?xml version="1.0" encoding="UTF-8"?><lists><list>'
+	entry dir src 4; entry file src/main.go 4; entry file src/main_test.go 2; entry file README 1; entry file logo.png 1
+	echo '</list></lists>' ;;
+list:*beta/branches/dev@30)
+	echo '<?xml version="1.0" encoding="UTF-8"?><lists><list>'
+	entry file cfg.go 9
+	echo '</list></lists>' ;;
+cat:*alpha/trunk/src/main.go@20) printf 'package main\nconst Key = "alpha"\n// key\n' ;;
+cat:*alpha/trunk/src/main_test.go@20) printf 'Key\n' ;;
+cat:*alpha/trunk/README@20) printf 'See Key.\n' ;;
+cat:*alpha/trunk/logo.png@20) printf 'Key\000' ;;
+cat:*beta/branches/dev/cfg.go@30) printf 'var key = 1\n' ;;
+*) echo "unexpected $*" >&2; exit 1 ;;
+esac`)
+
+	for _, tc := range []struct {
+		args []string
+		want string
+		warn string
+	}{
+		{
+			[]string{"-G", "key", "-X", "*_test.go", "alpha"},
+			"alpha:src/main.go@4:2:const Key = \"alpha\"\r\n" +
+				"alpha:src/main.go@4:3:// key\r\n" +
+				"alpha:README@1:1:See Key.\r\n",
+			"",
+		},
+		{
+			[]string{"-G", "Key", "-c", "-I", "src/*.go", "alpha"},
+			"alpha:src/main.go@4:2:const Key = \"alpha\"\r\n" +
+				"alpha:src/main_test.go@2:1:Key\r\n",
+			"",
+		},
+		{
+			[]string{"-G", "key", "-I", "*.go", "beta", "--", "@/branches/dev"},
+			"beta:cfg.go@9:1:var key = 1\r\n",
+			"",
+		},
+		{
+			// beta has no trunk, which does not prevent searching alpha.
+			[]string{"-G", "key", "-I", "*.go", "."},
+			"alpha:src/main.go@4:2:const Key = \"alpha\"\r\n" +
+				"alpha:src/main.go@4:3:// key\r\n" +
+				"alpha:src/main_test.go@2:1:Key\r\n",
+			"warning: skipping beta: svn info: exit status 1",
+		},
+	} {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		args := append([]string{"-f", cacheFile, "-s", "http://svn.example", "-j", "3"}, tc.args...)
+		if err := runMain(args, envLookup(nil), stdout, stderr); err != nil {
+			t.Fatalf("runMain(%q) returned error: %v\nstderr=%s", tc.args, err, stderr.String())
+		}
+		if stdout.String() != tc.want {
+			t.Fatalf("runMain(%q) printed:\n%s\nwant:\n%s", tc.args, stdout.String(), tc.want)
+		}
+		if tc.warn != "" && !strings.Contains(stderr.String(), tc.warn) {
+			t.Fatalf("runMain(%q) stderr missing %q:\n%s", tc.args, tc.warn, stderr.String())
+		}
+	}
+}
+
+func TestRunMatrix(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("alpha\nbeta\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+	// beta has no tags directory, which svn reports after listing branches.
+	fakeSVN(t, `entry() { echo "<entry kind=\"$1\"><name>$2</name><commit revision=\"$3\"></commit></entry>"; }
+echo '<?xml version="1.0" encoding="UTF-8"?><lists>'
+case "$5" in
+*alpha/branches)
+	echo "<list path=\"$5\">"; entry dir dev 5; entry file README 1; echo '</list>'
+	echo "<list path=\"$6\">"; entry dir v2.3 7; entry dir v2.4 9; echo '</list>' ;;
+*beta/branches)
+	echo "<list path=\"$5\">"; entry dir dev 3; entry dir old 2; echo '</list>' ;;
+esac
+echo '</lists>'
+case "$5" in *beta/*) echo "svn: E200009: Could not list all targets" >&2; exit 1 ;; esac`)
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{
+			nil,
+			"REPOSITORY  branches/dev  branches/old  tags/v2.3  tags/v2.4\r\n" +
+				"alpha       r5            ✗             r7         r9\r\n" +
+				"beta        r3            r2            ✗          ✗\r\n",
+		},
+		{
+			[]string{"-O", "csv", ".", "--", "dev", "tags/v2.3", "tags/v3.0"},
+			"profile,repository,branches/dev,tags/v2.3,tags/v3.0\r\n" +
+				",alpha,5,7,\r\n" +
+				",beta,3,,\r\n",
+		},
+	} {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		args := append([]string{"-f", cacheFile, "-s", "http://svn.example", "-b", "-j", "2"}, tc.args...)
+		if err := runMain(args, envLookup(nil), stdout, stderr); err != nil {
+			t.Fatalf("runMain(%q) returned error: %v\nstderr=%s", tc.args, err, stderr.String())
+		}
+		if stdout.String() != tc.want {
+			t.Fatalf("runMain(%q) printed:\n%s\nwant:\n%s", tc.args, stdout.String(), tc.want)
+		}
+	}
+}
+
+func TestRunTemplates(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("alpha\nteams/FCS\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+
+	stderr := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-d", "-V", ".", "--",
+			"copy", "-m", "@ {{.Index}}/{{.Count}} & ^", "{{.URL}}/trunk",
+			`{{.URL}}/branches/{{.Name | replace "/" "-" | lower}}`, `{{.Prev | trimPrefix "http://"}}`},
+		envLookup(nil),
+		&bytes.Buffer{},
+		stderr,
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v\nstderr=%s", err, stderr.String())
+	}
+	for _, want := range []string{
+		"» svn --force-interactive copy -m '@ 1/2 & ^' http://svn.example/svn/alpha/trunk " +
+			"http://svn.example/svn/alpha/branches/alpha svn.example/svn/alpha/branches/alpha",
+		"» svn --force-interactive copy -m '@ 2/2 & ^' http://svn.example/svn/teams/FCS/trunk " +
+			"http://svn.example/svn/teams/FCS/branches/teams-fcs svn.example/svn/teams/FCS/branches/teams-fcs",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Fatalf("stderr=%q, want command %q", stderr.String(), want)
+		}
+	}
+
+	err = runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-d", "-V", ".", "--", "info", "{{.Missing}}"},
+		envLookup(nil),
+		&bytes.Buffer{},
+		&bytes.Buffer{},
+	)
+	if err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Fatalf("got err=%v, want template error", err)
+	}
+}
+
+func TestExpandEscapes(t *testing.T) {
+	const (
+		repo = "teams/fcs"
+		url  = "http://svn.example/svn/" + repo
+	)
+	vars := map[string]string{"repo": repo}
+	for _, tc := range []struct {
+		arg, prec, want string
+	}{
+		{"fix 50%% of cases && more", "", "fix 50% of cases & more"},
+		{"=fix 50% of cases & more", "", "fix 50% of cases & more"},
+		{"==x", "", "=x"},
+		{"@@{repo}", "", "@teams/fcs"},
+		{"@/trunk@123", "", url + "/trunk@123"},
+		{"^^ ^ $$ !!", "", "^ fcs $ !"},
+		{"{{repo}} {{{repo}}} }}{", "", "{repo} {teams/fcs} }{"},
+		{"{{pin}}", "", "{pin}"},
+		// named parameters without a value are left unexpanded.
+		{"{pin}/{wc}", "", "{pin}/{wc}"},
+		{"%", url + "/tags/v1", "teams/fcs/tags/v1"},
+		{"%%/&&", url + "/tags/v1", "%/&"},
+		{"%:&", url + "/tags/v1", "teams/fcs/tags/v1:" + url + "/tags/v1"},
+		// values of parameters are not expanded again.
+		{"%", url + "/a&b$", "teams/fcs/a&b$"},
+		{"&", "x%y", "x%y"},
+		{"{repo}", "", "teams/fcs"},
+		{`^\d+%$`, "dir/file", `fcs\d+%file`},
+		{`=^\d+%$`, "dir/file", `^\d+%$`},
+	} {
+		if got := expand(tc.arg, url, repo, tc.prec, vars); got != tc.want {
+			t.Errorf("expand(%q, prec=%q) = %q, want %q", tc.arg, tc.prec, got, tc.want)
+		}
+	}
+}
+
+func TestForEach(t *testing.T) {
+	const n, workers = 50, 3
+	var running, peak atomic.Int32
+	seen := make([]int, n)
+	forEach(n, workers, func(i int) {
+		cur := running.Add(1)
+		for {
+			if p := peak.Load(); cur <= p || peak.CompareAndSwap(p, cur) {
+				break
+			}
+		}
+		seen[i]++
+		running.Add(-1)
+	})
+	for i, c := range seen {
+		if c != 1 {
+			t.Errorf("index %d called %d times, want 1", i, c)
+		}
+	}
+	if p := peak.Load(); p > workers {
+		t.Errorf("%d calls at once, want at most %d", p, workers)
+	}
+}
+
+func TestRunExpansionVariables(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.json")
+	data := `{"version": 1, "repos": [{"name": "alpha", "revision": 42}, {"name": "teams/beta"}]}`
+	if err := os.WriteFile(cacheFile, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+
+	for _, tc := range []struct {
+		flag string
+		args []string
+		want []string
+	}{
+		{
+			"-c",
+			[]string{"--", "export", "@/trunk@{rev}", "{index}-of-{count}", "{server}", "{web}"},
+			[]string{
+				"» svn --force-interactive export http://svn.example/svn/alpha/trunk@42 1-of-2 " +
+					"http://svn.example/svn http://web.example/alpha",
+				// the youngest revision of beta is not cached.
+				"» svn --force-interactive export 'http://svn.example/svn/teams/beta/trunk@{rev}' 2-of-2 " +
+					"http://svn.example/svn http://web.example/teams/beta",
+			},
+		},
+		{
+			"-V",
+			[]string{"--", "info", "{{.Server}}", "{{.Index}}/{{.Count}}:{{.Rev}}"},
+			[]string{
+				"» svn --force-interactive info http://svn.example/svn 1/2:42",
+				"» svn --force-interactive info http://svn.example/svn 2/2:",
+			},
+		},
+	} {
+		stderr := &bytes.Buffer{}
+		args := append([]string{"-f", cacheFile, "-s", "http://svn.example", "-W", "http://web.example", "-d", tc.flag, "."}, tc.args...)
+		if err := runMain(args, envLookup(nil), &bytes.Buffer{}, stderr); err != nil {
+			t.Fatalf("runMain(%q) returned error: %v\nstderr=%s", tc.args, err, stderr.String())
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(stderr.String(), want) {
+				t.Fatalf("runMain(%q) stderr=%q, want command %q", tc.args, stderr.String(), want)
+			}
+		}
+	}
+
+	// the same parameters are expanded in the arguments of other modes, e.g.,
+	// the log (-H), whose fake messages are the URLs logged.
+	fakeSVN(t, `for url; do :; done
+echo "<log><logentry revision=\"1\"><date>2026-01-01T00:00:00Z</date><msg>$url</msg></logentry></log>"`)
+	stdout := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-H", "-O", "json", ".", "--", "@/{index}-of-{count}@{rev}"},
+		envLookup(nil),
+		stdout,
+		&bytes.Buffer{},
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v", err)
+	}
+	for _, want := range []string{
+		"http://svn.example/svn/alpha/1-of-2@42",
+		"http://svn.example/svn/teams/beta/2-of-2@{rev}",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Fatalf("stdout=%q, want log of %q", stdout.String(), want)
+		}
+	}
+}
+
+func TestRunKeepGoingSummarizesFailures(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("alpha\nbeta\ngamma\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+	fakeSVN(t, `case "$3" in *beta) echo "E170000: no such repo" 1>&2; exit 3 ;; esac
+echo "out $3"`)
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-k", "-q", ".", "--", "info", "@"},
+		envLookup(nil),
+		stdout,
+		stderr,
+	)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 repositories failed") {
+		t.Fatalf("got err=%v, want failure count", err)
+	}
+	if !strings.Contains(stdout.String(), "out http://svn.example/svn/gamma") {
+		t.Fatalf("stdout=%q, want output from repository after failure", stdout.String())
+	}
+	for _, want := range []string{
+		"beta        failed  3     E170000: no such repo",
+		"2 succeeded, 1 failed, 0 skipped",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Fatalf("stderr=%q, want summary containing %q", stderr.String(), want)
+		}
+	}
+}
+
+func TestRunJSONRecords(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("alpha\nbeta\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+	fakeSVN(t, `case "$3" in *beta) echo "boom" 1>&2; exit 2 ;; esac
+echo "out $3"`)
+
+	stdout := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-O", "json", "-k", "-q", ".", "--", "info", "@"},
+		envLookup(nil),
+		stdout,
+		&bytes.Buffer{},
+	)
+	if err == nil {
+		t.Fatal("expected error for failed repository")
+	}
+
+	var recs []record
+	dec := json.NewDecoder(stdout)
+	for dec.More() {
+		var rec record
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2: %+v", len(recs), recs)
+	}
+	alpha, beta := recs[0], recs[1]
+	if alpha.Name != "alpha" || alpha.URL != "http://svn.example/svn/alpha" ||
+		alpha.WebURL != "http://svn.example/viewvc/alpha" {
+		t.Fatalf("got record %+v, want alpha URLs", alpha)
+	}
+	if alpha.ExitCode == nil || *alpha.ExitCode != 0 || alpha.Stdout != "out http://svn.example/svn/alpha\n" {
+		t.Fatalf("got record %+v, want successful alpha", alpha)
+	}
+	wantArgv := []string{"svn", "--force-interactive", "info", "http://svn.example/svn/beta"}
+	if strings.Join(beta.Argv, " ") != strings.Join(wantArgv, " ") {
+		t.Fatalf("got argv %q, want %q", beta.Argv, wantArgv)
+	}
+	if beta.ExitCode == nil || *beta.ExitCode != 2 || beta.Stderr != "boom\n" || beta.Status != "failed" {
+		t.Fatalf("got record %+v, want failed beta", beta)
+	}
+}
+
+func TestRunAllProfiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Chdir(home)
+	for name, data := range map[string]string{
+		"one.txt": "alpha\nbeta\n",
+		"two.txt": "alpine\n",
+		configName: `{"profiles": {
+			"one": {"server": "http://one.example", "cache": "` + filepath.Join(home, "one.txt") + `"},
+			"two": {"server": "http://two.example", "args": "--non-interactive", "cache": "` + filepath.Join(home, "two.txt") + `"}
+		}}`,
+	} {
+		if err := os.WriteFile(filepath.Join(home, name), []byte(data), 0o600); err != nil {
+			t.Fatalf("WriteFile(%q): %v", name, err)
+		}
+	}
+
+	stdout := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-A", "-s", "http://flag.example", "^al"},
+		envLookup(map[string]string{svnURLIdent: "http://env.example"}),
+		stdout,
+		&bytes.Buffer{},
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v", err)
+	}
+	want := strings.Join([]string{
+		"http://flag.example/svn/alpha",
+		"http://flag.example/svn/alpine",
+	}, newline) + newline
+	if stdout.String() != want {
+		t.Fatalf("stdout=%q want %q", stdout.String(), want)
+	}
+
+	stderr := &bytes.Buffer{}
+	err = runMain(
+		[]string{"-A", "-d", "^al", "--", "checkout", "@", "{profile}/^"},
+		envLookup(map[string]string{svnURLIdent: "http://env.example"}),
+		&bytes.Buffer{},
+		stderr,
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v", err)
+	}
+	for _, want := range []string{
+		"» svn --force-interactive checkout http://one.example/svn/alpha one/alpha",
+		"» svn --non-interactive checkout http://two.example/svn/alpine two/alpine",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Fatalf("stderr=%q, want command %q", stderr.String(), want)
+		}
+	}
+}
+
+func TestRunConfigPrecedence(t *testing.T) {
+	userDir := t.TempDir()
+	projDir := t.TempDir()
+	workDir := filepath.Join(projDir, "sub", "dir")
+	if err := os.MkdirAll(workDir, 0o700); err != nil {
+		t.Fatalf("MkdirAll(%q): %v", workDir, err)
+	}
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+	t.Chdir(workDir)
+
+	userFile := filepath.Join(userDir, configDir, configFile)
+	projFile := filepath.Join(projDir, configName)
+	for path, data := range map[string]string{
+		userFile: `{"flags": {"s": "http://user.example", "W": "http://user.example/web", "j": 2, "k": true}}`,
+		projFile: `{"flags": {"s": "http://project.example", "W": "http://project.example/web", "j": 4}}`,
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("MkdirAll(%q): %v", path, err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("WriteFile(%q): %v", path, err)
+		}
+	}
+
+	stdout := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-E", "-j", "8"},
+		envLookup(map[string]string{webURLIdent: "http://env.example/web"}),
+		stdout,
+		&bytes.Buffer{},
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v", err)
+	}
+
+	got := map[string][2]string{}
+	for _, line := range strings.Split(stdout.String(), newline) {
+		if f := strings.Fields(line); len(f) >= 3 {
+			got[f[0]] = [2]string{f[1], strings.Join(f[2:], " ")}
+		}
+	}
+	for name, want := range map[string][2]string{
+		"-s": {"http://project.example", projFile},
+		"-W": {"http://env.example/web", "$" + webURLIdent},
+		"-j": {"8", "command line"},
+		"-k": {"true", userFile},
+		"-d": {"false", "default"},
+	} {
+		if got[name] != want {
+			t.Fatalf("got %s = %q, want %q\n%s", name, got[name], want, stdout.String())
+		}
+	}
+}
+
+func TestRunSaveGroup(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("DAPA_Calc\nDAPA_Project\nMisc\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+
+	err := runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-N", "dapa", "^DAPA", "!Calc"},
+		envLookup(nil),
+		&bytes.Buffer{},
+		&bytes.Buffer{},
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v", err)
+	}
+
+	stdout := &bytes.Buffer{}
+	err = runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", cache.GroupPrefix + "dapa"},
+		envLookup(nil),
+		stdout,
+		&bytes.Buffer{},
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v", err)
+	}
+	want := "http://svn.example/svn/DAPA_Project" + newline
+	if stdout.String() != want {
+		t.Fatalf("stdout=%q want %q", stdout.String(), want)
+	}
+}
+
+func TestRunExplain(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("DAPA_Calc\nDAPA_Project\nMisc\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+
+	stdout := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-o", "^DAPA", "Proj", "!Calc"},
+		envLookup(nil),
+		stdout,
+		&bytes.Buffer{},
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v", err)
+	}
+	want := "http://svn.example/svn/DAPA_Project" + newline
+	if stdout.String() != want {
+		t.Fatalf("stdout=%q want %q (once)", stdout.String(), want)
+	}
+
+	stdout.Reset()
+	err = runMain(
+		[]string{"-f", cacheFile, "-s", "http://svn.example", "-x", "-o", "^DAPA", "Proj", "!Calc"},
+		envLookup(nil),
+		stdout,
+		&bytes.Buffer{},
+	)
+	if err != nil {
+		t.Fatalf("runMain returned error: %v", err)
+	}
+	for _, want := range []string{
+		"DAPA_Calc     ignored   ^DAPA        Proj         Calc",
+		"DAPA_Project  selected  ^DAPA, Proj  -            -",
+		"Misc          skipped   -            ^DAPA, Proj  -",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Fatalf("stdout=%q, want line %q", stdout.String(), want)
+		}
+	}
+}
+
+func TestRunUpdateReportsDiff(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheFile := filepath.Join(tempDir, "repos.txt")
+	if err := os.WriteFile(cacheFile, []byte("alpha\nbeta\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile(%q): %v", cacheFile, err)
+	}
+	sshScript := writeScript(t, tempDir, "list-repos.sh", "printf 'alpha\\ngamma\\n'")
+
+	stdout := &bytes.Buffer{}
+	err := runMain(
+		[]string{"-u", "-D", "-O", "json", "-f", cacheFile, "-s", "http://svn.example"},
+		envLookup(map[string]string{svnSSHIdent: sshScript}),
+		stdout,
+		&bytes.Buffer{},
+	)
+	if err == nil || !strings.Contains(err.Error(), "1 repositories removed") {
+		t.Fatalf("got err=%v, want failure for removed repository", err)
+	}
+
+	var d struct {
+		Cache   string
+		Added   []string
+		Removed []string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &d); err != nil {
+		t.Fatalf("Unmarshal(%q): %v", stdout.String(), err)
+	}
+	if d.Cache != cacheFile || strings.Join(d.Added, " ") != "gamma" || strings.Join(d.Removed, " ") != "beta" {
+		t.Fatalf("got diff %+v, want gamma added and beta removed", d)
+	}
+}
+
 func envLookup(values map[string]string) func(string) (string, bool) {
 	return func(key string) (string, bool) {
 		value, ok := values[key]
@@ -156,3 +1237,12 @@ func writeScript(t *testing.T, dir, name, body string) string {
 	}
 	return path
 }
+
+// fakeSVN installs a shell script named "svn" with the given body at the front
+// of PATH for the duration of the test.
+func fakeSVN(t *testing.T, body string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeScript(t, dir, "svn", body)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// refDirs are the directories, relative to the repository root, whose entries
+// are the branches and tags of a repository.
+var refDirs = []string{"branches", "tags"}
+
+// refs are the branches and tags of a repository, keyed by path relative to
+// the repository root (e.g., "tags/v2.3"), with the revision each was last
+// changed.
+type refs map[string]int64
+
+// refRow is the JSON representation of a row of the branch and tag matrix.
+type refRow struct {
+	Profile string   `json:"profile,omitempty"`
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Present refs     `json:"present"`
+	Missing []string `json:"missing"`
+}
+
+// matrix lists the branches and tags of each repository in match, running up
+// to workers "svn list" commands at once, and returns the names selected by
+// the given globs (or all names, if none are given) along with the branches
+// and tags of each repository. A glob without special characters that names
+// a path in a branches or tags directory (e.g., "tags/v2.3") is always
+// selected, even if no repository has it.
+func matrix(match []target, globs pathGlobs, workers int) ([]string, []refs, error) {
+	rows := make([]refs, len(match))
+	errs := make([]error, len(match))
+	forEach(len(match), workers, func(i int) {
+		rows[i], errs[i] = listRefs(match[i], match[i].vars(i, len(match)))
+	})
+
+	var names []string
+	for _, glob := range globs {
+		dir, _, ok := strings.Cut(glob, "/")
+		if ok && slices.Contains(refDirs, dir) && !strings.ContainsAny(glob, `*?[\`) {
+			names = append(names, glob)
+		}
+	}
+	for i := range match {
+		if errs[i] != nil {
+			return nil, nil, fmt.Errorf("error: %s: %w", match[i].repo, errs[i])
+		}
+		for name := range rows[i] {
+			if len(globs) == 0 || globs.match(name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names), rows, nil
+}
+
+// listRefs returns the branches and tags of repository t, with named
+// parameters vars, using a single "svn list" command. A repository without a
+// branches or tags directory has no entries in that directory.
+func listRefs(t target, vars map[string]string) (refs, error) {
+	url := t.site.url(t.repo, false)
+	arg := append(append([]string{}, t.site.svnArgs...), "list", "--xml", "--")
+	for _, dir := range refDirs {
+		arg = append(arg, expand("@/"+dir, url, t.repo, "", vars))
+	}
+	var stdout, stderr bytes.Buffer
+	// svn reports the directories that do not exist as warnings, but still
+	// lists the directories that do exist.
+	err := runSVN("", &stdout, &stderr, arg...)
+	var lists struct {
+		List []struct {
+			Path    string `xml:"path,attr"`
+			Entries []struct {
+				Kind   string `xml:"kind,attr"`
+				Name   string `xml:"name"`
+				Commit struct {
+					Revision int64 `xml:"revision,attr"`
+				} `xml:"commit"`
+			} `xml:"entry"`
+		} `xml:"list"`
+	}
+	if perr := xml.Unmarshal(stdout.Bytes(), &lists); perr != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid output from svn list: %w", perr)
+	}
+	found := refs{}
+	for _, l := range lists.List {
+		dir := strings.Trim(strings.TrimPrefix(l.Path, url), "/")
+		for _, e := range l.Entries {
+			if e.Kind == "dir" {
+				found[dir+"/"+e.Name] = e.Commit.Revision
+			}
+		}
+	}
+	return found, nil
+}
+
+// printMatrix writes the given branch and tag matrix to w in the given format.
+// In text format, each branch or tag present in a repository is shown with the
+// revision it was last changed, and each missing is shown as "✗".
+func printMatrix(w io.Writer, match []target, names []string, rows []refs, format string) error {
+	switch format {
+	case formatJSON:
+		for i, t := range match {
+			row := refRow{
+				Profile: t.site.profile,
+				Name:    t.repo,
+				URL:     t.site.url(t.repo, false),
+				Present: refs{},
+				Missing: []string{},
+			}
+			for _, name := range names {
+				if rev, ok := rows[i][name]; ok {
+					row.Present[name] = rev
+				} else {
+					row.Missing = append(row.Missing, name)
+				}
+			}
+			if err := writeJSON(w, row); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		cw.UseCRLF = true
+		if err := cw.Write(append([]string{"profile", "repository"}, names...)); err != nil {
+			return err
+		}
+		for i, t := range match {
+			line := []string{t.site.profile, t.repo}
+			for _, name := range names {
+				cell := ""
+				if rev, ok := rows[i][name]; ok {
+					cell = strconv.FormatInt(rev, 10)
+				}
+				line = append(line, cell)
+			}
+			if err := cw.Write(line); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "REPOSITORY")
+	for _, name := range names {
+		fmt.Fprint(tw, "\t"+name)
+	}
+	fmt.Fprint(tw, newline)
+	for i, t := range match {
+		fmt.Fprint(tw, t.repo)
+		for _, name := range names {
+			if rev, ok := rows[i][name]; ok {
+				fmt.Fprintf(tw, "\tr%d", rev)
+			} else {
+				fmt.Fprint(tw, "\t✗")
+			}
+		}
+		fmt.Fprint(tw, newline)
+	}
+	return tw.Flush()
+}
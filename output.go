@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+func validFormat(format string, valid ...string) error {
+	for _, v := range valid {
+		if format == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid output format %q: must be one of %q", format, valid)
+}
+
+// record is the JSON representation of a repository and, if a command was
+// generated for it, the result of that command.
+type record struct {
+	Profile     string   `json:"profile,omitempty"`
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	WebURL      string   `json:"web_url"`
+	WorkingCopy string   `json:"working_copy,omitempty"`
+	Action      string   `json:"action,omitempty"`
+	Argv        []string `json:"argv,omitempty"`
+	Status      string   `json:"status,omitempty"`
+	ExitCode    *int     `json:"exit_code,omitempty"`
+	Duration    float64  `json:"duration,omitempty"` // seconds
+	Stdout      string   `json:"stdout,omitempty"`
+	Stderr      string   `json:"stderr,omitempty"`
+}
+
+// writeJSON writes v to w as a single line of JSON (NDJSON).
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
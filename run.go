@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+type jobStatus int
+
+const (
+	jobSkipped jobStatus = iota
+	jobSucceeded
+	jobFailed
+)
+
+func (s jobStatus) String() string {
+	switch s {
+	case jobSucceeded:
+		return "ok"
+	case jobFailed:
+		return "failed"
+	default:
+		return "skipped"
+	}
+}
+
+// job is a single expanded SVN command bound to one matched repository.
+type job struct {
+	profile string
+	repo    string
+	url     string
+	webURL  string
+	dir     string // working copy in which the command is run, if any
+	wc      string // working copy on which the command operates, if any
+	action  string // action taken on a working copy of a workspace, if any
+	args    []string
+
+	// stdout and stderr hold the output of the command when run concurrently,
+	// so that it can be emitted as one group in the original order.
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+
+	status  jobStatus
+	err     error
+	elapsed time.Duration
+	done    chan struct{}
+}
+
+func newJob(repo string, args []string) *job {
+	return &job{repo: repo, args: args, done: make(chan struct{})}
+}
+
+// String returns the command line of j as it would be typed into a shell.
+func (j *job) String() string {
+	var cli strings.Builder
+	quote := func(s string) {
+		if strings.ContainsAny(s, " \t\n$&|<>;`~#{}[]*?!") {
+			cli.WriteString("'")
+			cli.WriteString(s)
+			cli.WriteString("'")
+		} else {
+			cli.WriteString(s)
+		}
+	}
+	if j.dir != "" {
+		cli.WriteString("cd ")
+		quote(j.dir)
+		cli.WriteString(" && ")
+	}
+	cli.WriteString("svn")
+	for _, s := range j.args {
+		cli.WriteRune(' ')
+		quote(s)
+	}
+	return cli.String()
+}
+
+func (j *job) run(stdout, stderr io.Writer) {
+	start := time.Now()
+	j.err = runSVN(j.dir, stdout, stderr, j.args...)
+	j.elapsed = time.Since(start)
+	if j.err != nil {
+		j.status = jobFailed
+	} else {
+		j.status = jobSucceeded
+	}
+}
+
+// record returns the JSON representation of j and its result.
+func (j *job) record() record {
+	rec := record{
+		Profile:     j.profile,
+		Name:        j.repo,
+		URL:         j.url,
+		WebURL:      j.webURL,
+		WorkingCopy: j.wc,
+		Action:      j.action,
+		Argv:        append([]string{"svn"}, nonEmpty(j.args...)...),
+		Status:      j.status.String(),
+		Stdout:      j.stdout.String(),
+		Stderr:      j.stderr.String(),
+	}
+	if j.status != jobSkipped {
+		code := 0
+		var se *svnError
+		if errors.As(j.err, &se) {
+			code = se.ExitCode()
+		}
+		rec.ExitCode = &code
+		rec.Duration = j.elapsed.Seconds()
+	}
+	return rec
+}
+
+// runner executes jobs and reports their results.
+type runner struct {
+	workers   int    // maximum number of jobs executed at once
+	dryRun    bool   // only print the jobs, do not execute them
+	keepGoing bool   // continue executing jobs after a job fails
+	format    string // output format, formatText or formatJSON
+	stdout    io.Writer
+	stderr    io.Writer
+}
+
+// run executes each job in the given order, or only prints them if r.dryRun is
+// true.
+//
+// If r.workers is greater than 1, up to that many jobs are executed at once.
+// The output of each concurrent job is buffered and then emitted in the same
+// order the jobs were given, so that the output of different repositories is
+// never interleaved.
+//
+// Unless r.keepGoing is true, the first job to fail prevents any pending jobs
+// from starting, and its error is returned once all running jobs have
+// finished. Otherwise, every job is executed and a summary of all results is
+// printed once they have finished.
+//
+// If r.format is formatJSON, the output of each job is captured and printed
+// along with its result as a JSON record instead.
+func (r *runner) run(jobs []*job) error {
+	var err error
+	switch {
+	case r.dryRun:
+		for _, j := range jobs {
+			log.Println("» " + j.String())
+			if r.format == formatJSON {
+				if err := writeJSON(r.stdout, j.record()); err != nil {
+					return err
+				}
+			}
+		}
+	case r.format == formatText && (r.workers <= 1 || len(jobs) <= 1):
+		for _, j := range jobs {
+			log.Println("» " + j.String())
+			if j.run(r.stdout, r.stderr); j.err != nil && !r.keepGoing {
+				return fmt.Errorf("error: %w", j.err)
+			}
+		}
+	default:
+		err = r.runConcurrent(jobs)
+	}
+	if !r.keepGoing {
+		return err
+	}
+	return r.summarize(jobs)
+}
+
+func (r *runner) runConcurrent(jobs []*job) error {
+	var stop atomic.Bool
+	queue := make(chan *job)
+	var wg sync.WaitGroup
+	for range max(1, min(r.workers, len(jobs))) {
+		wg.Go(func() {
+			for j := range queue {
+				if !stop.Load() {
+					if j.run(&j.stdout, &j.stderr); j.err != nil && !r.keepGoing {
+						stop.Store(true)
+					}
+				}
+				close(j.done)
+			}
+		})
+	}
+	go func() {
+		defer close(queue)
+		for _, j := range jobs {
+			queue <- j
+		}
+	}()
+
+	var first error
+	for _, j := range jobs {
+		<-j.done
+		if j.status != jobSkipped {
+			log.Println("» " + j.String())
+		}
+		if r.format == formatJSON {
+			if err := writeJSON(r.stdout, j.record()); err != nil && first == nil {
+				first = err
+			}
+		} else {
+			r.stdout.Write(j.stdout.Bytes())
+			r.stderr.Write(j.stderr.Bytes())
+		}
+		if j.err != nil && first == nil {
+			first = fmt.Errorf("error: %w", j.err)
+		}
+	}
+	wg.Wait()
+	return first
+}
+
+// forEach calls fn with each index from 0 to n-1, making up to workers calls
+// at once, and returns once every call has returned.
+func forEach(n, workers int, fn func(i int)) {
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range max(1, min(workers, n)) {
+		wg.Go(func() {
+			for i := range next {
+				fn(i)
+			}
+		})
+	}
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// summarize prints a table of the results of all jobs and returns an error if
+// any job failed.
+func (r *runner) summarize(jobs []*job) error {
+	count := map[jobStatus]int{}
+	tw := tabwriter.NewWriter(r.stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "REPOSITORY\tSTATUS\tEXIT\tMESSAGE"+newline)
+	for _, j := range jobs {
+		count[j.status]++
+		var exit, msg string
+		if j.status != jobSkipped {
+			exit = "0"
+		}
+		var se *svnError
+		if errors.As(j.err, &se) {
+			exit = fmt.Sprint(se.ExitCode())
+			msg, _, _ = strings.Cut(se.Stderr, "\n")
+			msg = strings.TrimSpace(msg)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s"+newline, j.repo, j.status, exit, msg)
+	}
+	tw.Flush()
+	fmt.Fprintf(r.stderr, "%d succeeded, %d failed, %d skipped"+newline,
+		count[jobSucceeded], count[jobFailed], count[jobSkipped])
+	if n := count[jobFailed]; n > 0 {
+		return fmt.Errorf("error: %d of %d repositories failed", n, len(jobs))
+	}
+	return nil
+}
+
+// svnError describes an SVN command that failed or wrote to stderr.
+type svnError struct {
+	Err    error  // error returned by the command, nil if it exited normally
+	Stderr string // everything the command wrote to stderr
+}
+
+func (e *svnError) Error() string {
+	switch {
+	case e.Err == nil:
+		return e.Stderr
+	case e.Stderr == "":
+		return e.Err.Error()
+	default:
+		return fmt.Sprintf("%v\r\n%s", e.Err, e.Stderr)
+	}
+}
+
+func (e *svnError) Unwrap() error { return e.Err }
+
+// ExitCode returns the exit status of the command, or -1 if it did not exit
+// normally (e.g., it could not be started).
+func (e *svnError) ExitCode() int {
+	if e.Err == nil {
+		return 0
+	}
+	var ee *exec.ExitError
+	if errors.As(e.Err, &ee) {
+		return ee.ExitCode()
+	}
+	return -1
+}
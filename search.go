@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// maxSearchSize is the size of the largest file searched, in bytes.
+const maxSearchSize = 16 << 20
+
+// pathGlobs is a list of shell globs matching file paths, given by repeating a
+// flag or separating globs with spaces.
+type pathGlobs []string
+
+func (g *pathGlobs) Set(s string) error {
+	for _, glob := range strings.Fields(s) {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+		*g = append(*g, glob)
+	}
+	return nil
+}
+
+func (g *pathGlobs) String() string {
+	if g == nil {
+		return ""
+	}
+	return strings.Join(*g, " ")
+}
+
+// match reports whether any glob matches name, which is a "/"-separated path.
+// Globs without "/" match the base name of the path, and all other globs
+// match the entire path.
+func (g pathGlobs) match(name string) bool {
+	for _, glob := range g {
+		subject := name
+		if !strings.Contains(glob, "/") {
+			subject = path.Base(name)
+		}
+		if ok, _ := path.Match(glob, subject); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// searchFile is a file found in a repository to search.
+type searchFile struct {
+	target
+	root     string // URL of the directory searched
+	path     string // path of the file relative to root
+	peg      int64  // revision at which root was listed
+	revision int64  // last-changed revision of the file
+}
+
+// searchMatch is a line of a file matching a search pattern.
+type searchMatch struct {
+	Profile  string `json:"profile,omitempty"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Path     string `json:"path"`
+	Revision int64  `json:"revision"`
+	Line     int    `json:"line"`
+	Text     string `json:"text"`
+}
+
+// search returns the lines matching re in every file beneath path root (e.g.,
+// "trunk" or "@/trunk") of each repository in match, running up to workers SVN
+// commands at once. Only files whose paths (relative to root) match any of the
+// include globs, if given, and none of the exclude globs are searched. Binary
+// files, files larger than maxSearchSize, and repositories in which root cannot
+// be listed (e.g., because it does not exist) are skipped.
+func search(match []target, root string, re *regexp.Regexp, include, exclude pathGlobs, workers int) ([]searchMatch, error) {
+	lists := make([][]searchFile, len(match))
+	errs := make([]error, len(match))
+	forEach(len(match), workers, func(i int) {
+		lists[i], errs[i] = listFiles(match[i], match[i].vars(i, len(match)), root, include, exclude)
+	})
+
+	var files []searchFile
+	for i := range match {
+		if errs[i] != nil {
+			log.Printf("warning: skipping %s: %v\n", match[i].repo, errs[i])
+			continue
+		}
+		files = append(files, lists[i]...)
+	}
+
+	found := make([][]searchMatch, len(files))
+	forEach(len(files), workers, func(i int) {
+		var err error
+		if found[i], err = grepFile(files[i], re); err != nil {
+			log.Printf("warning: skipping %s/%s: %v\n", files[i].root, files[i].path, err)
+		}
+	})
+
+	var merged []searchMatch
+	for i := range files {
+		merged = append(merged, found[i]...)
+	}
+	return merged, nil
+}
+
+// listFiles returns the files beneath path root of repository t, expanded with
+// named parameters vars, selected by the include and exclude globs.
+//
+// The files are listed as of the youngest revision of the repository, which is
+// also the peg revision at which each is fetched. A file is not necessarily
+// found at its own last-changed revision, e.g., if it is in a branch copied
+// since, or if one of its parents was moved since.
+func listFiles(t target, vars map[string]string, root string, include, exclude pathGlobs) ([]searchFile, error) {
+	rel, err := repoPath(root, t, vars)
+	if err != nil {
+		return nil, err
+	}
+	url := t.site.url(t.repo, false)
+	if rel != "" {
+		url += "/" + rel
+	}
+	info, err := queryInfo(t.site.svnArgs, "", url)
+	var se *svnError
+	if errors.As(err, &se) {
+		return nil, fmt.Errorf("svn info: %w", se)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(info) == 0 {
+		return nil, fmt.Errorf("no such path: %s", url)
+	}
+	peg := info[0].Revision
+	var stdout, stderr bytes.Buffer
+	arg := append(append([]string{}, t.site.svnArgs...), "list", "-R", "--xml", "--", fmt.Sprintf("%s@%d", url, peg))
+	if err := runSVN("", &stdout, &stderr, arg...); err != nil {
+		return nil, fmt.Errorf("svn list: %w", err)
+	}
+	var lists struct {
+		Entries []struct {
+			Kind   string `xml:"kind,attr"`
+			Name   string `xml:"name"`
+			Size   int64  `xml:"size"`
+			Commit struct {
+				Revision int64 `xml:"revision,attr"`
+			} `xml:"commit"`
+		} `xml:"list>entry"`
+	}
+	if err := xml.Unmarshal(stdout.Bytes(), &lists); err != nil {
+		return nil, fmt.Errorf("invalid output from svn list: %w", err)
+	}
+	var files []searchFile
+	for _, e := range lists.Entries {
+		switch {
+		case e.Kind != "file":
+		case len(include) > 0 && !include.match(e.Name):
+		case exclude.match(e.Name):
+		case e.Size > maxSearchSize:
+			log.Printf("warning: skipping %s/%s: larger than %d bytes\n", url, e.Name, maxSearchSize)
+		default:
+			files = append(files, searchFile{target: t, root: url, path: e.Name, peg: peg, revision: e.Commit.Revision})
+		}
+	}
+	return files, nil
+}
+
+// grepFile returns the lines of file f matching re, or nothing if f is binary.
+func grepFile(f searchFile, re *regexp.Regexp) ([]searchMatch, error) {
+	var stdout, stderr bytes.Buffer
+	url := fmt.Sprintf("%s/%s@%d", f.root, f.path, f.peg)
+	arg := append(append([]string{}, f.site.svnArgs...), "cat", "--", url)
+	if err := runSVN("", &stdout, &stderr, arg...); err != nil {
+		return nil, err
+	}
+	data := stdout.Bytes()
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return nil, nil // binary
+	}
+	var found []searchMatch
+	scan := bufio.NewScanner(bytes.NewReader(data))
+	scan.Buffer(nil, maxSearchSize)
+	for n := 1; scan.Scan(); n++ {
+		if line := scan.Text(); re.MatchString(line) {
+			found = append(found, searchMatch{
+				Profile:  f.site.profile,
+				Name:     f.repo,
+				URL:      f.root,
+				Path:     f.path,
+				Revision: f.revision,
+				Line:     n,
+				Text:     line,
+			})
+		}
+	}
+	return found, scan.Err()
+}
+
+// printSearch writes the given search results to w in the given format.
+func printSearch(w io.Writer, found []searchMatch, format string) error {
+	for _, m := range found {
+		if format == formatJSON {
+			if err := writeJSON(w, m); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(w, "%s:%s@%d:%d:%s"+newline, m.Name, m.Path, m.Revision, m.Line, m.Text)
+	}
+	return nil
+}
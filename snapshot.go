@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// snapshot records the revision of each repository in match to a manifest
+// written to w, in the format of a workspace manifest.
+//
+// If arg is empty, the youngest revision of each repository is recorded.
+// Otherwise, arg is expanded for each repository into the path (or URL) of the
+// path within the repository whose last-changed revision is recorded, e.g.,
+// "@/trunk" or "trunk".
+func snapshot(w io.Writer, match []target, arg string) error {
+	ws := workspace{Created: time.Now().UTC().Truncate(time.Second)}
+	bySite := map[*site][]int{}
+	var urls []string
+	for n, t := range match {
+		url := t.site.url(t.repo, false)
+		rel, err := repoPath(arg, t, t.vars(n, len(match)))
+		if err != nil {
+			return err
+		}
+		e := checkout{Profile: t.site.profile, Repo: t.repo, Path: rel}
+		bySite[t.site] = append(bySite[t.site], len(ws.Entries))
+		ws.Entries = append(ws.Entries, e)
+		urls = append(urls, e.url(url))
+	}
+
+	// query all repositories of each site at once.
+	for s, index := range bySite {
+		target := make([]string, len(index))
+		for i, n := range index {
+			target[i] = urls[n]
+		}
+		info, err := queryInfo(s.svnArgs, "", target...)
+		if err != nil {
+			return err
+		}
+		if len(info) != len(index) {
+			return fmt.Errorf("error: svn info reported %d of %d URLs", len(info), len(index))
+		}
+		for i, n := range index {
+			rev := info[i].Commit.Revision
+			if rev == 0 {
+				rev = info[i].Revision
+			}
+			ws.Entries[n].Revision = revision(fmt.Sprint(rev))
+		}
+	}
+
+	data, err := json.MarshalIndent(ws, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// writeSnapshot records a snapshot of the repositories in match to file, or to
+// stdout if file is "-".
+func writeSnapshot(file string, stdout io.Writer, match []target, arg string) error {
+	if file == "-" {
+		return snapshot(stdout, match, arg)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	if err := snapshot(f, match, arg); err != nil {
+		f.Close()
+		os.Remove(file)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	log.Printf("recorded %d repositories in %s\n", len(match), file)
+	return nil
+}
+
+// pins returns the revision recorded for each repository in the manifest file
+// that is also in match, in the order of match. Repositories in match that are
+// not in the manifest are skipped with a warning.
+func pins(file string, sites []*site, match []target) ([]target, map[target]revision, error) {
+	ws, err := loadWorkspace(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	pin := map[target]revision{}
+	for _, e := range ws.Entries {
+		t, err := e.target(sites)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := pin[t]; !ok && e.Revision != "" {
+			pin[t] = e.Revision
+		}
+	}
+	var pinned []target
+	for _, t := range match {
+		// a target in match may be a working copy of the repository pinned.
+		if _, ok := pin[target{site: t.site, repo: t.repo}]; !ok {
+			log.Printf("warning: skipping %s: no revision recorded in %s\n", t.repo, file)
+			continue
+		}
+		pinned = append(pinned, t)
+	}
+	return pinned, pin, nil
+}
+
+// pegArgs reports which of the given SVN command arguments are pinned to the
+// recorded revision of each repository with a peg revision (-P): each argument
+// beginning with the repository URL ("@"), unless it already has a peg
+// revision or is a destination operand, which svn does not allow to have one.
+// The destination is the last URL of "copy" and "move", and every URL of
+// "mkdir", "import", and "delete".
+func pegArgs(arg []string) []bool {
+	peg := make([]bool, len(arg))
+	last := -1
+	for i, s := range arg {
+		if isURLArg(s) {
+			peg[i] = !strings.Contains(s[1:], "@")
+			last = i
+		}
+	}
+	sub := ""
+	for _, s := range arg {
+		if !strings.HasPrefix(s, "-") {
+			sub = s
+			break
+		}
+	}
+	switch sub {
+	case "copy", "cp", "move", "mv", "rename", "ren":
+		if last >= 0 {
+			peg[last] = false
+		}
+	case "mkdir", "import", "delete", "del", "remove", "rm":
+		clear(peg)
+	}
+	return peg
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// repoPath returns arg, expanded for repository t with named parameters vars,
+// as a path relative to the root of the repository. The expanded arg may be
+// either a relative path (e.g., "tags/foo") or a URL in the repository (e.g.,
+// "@/tags/foo").
+func repoPath(arg string, t target, vars map[string]string) (string, error) {
+	url := t.site.url(t.repo, false)
+	rel := strings.Trim(expand(arg, url, t.repo, "", vars), "/")
+	if p, ok := strings.CutPrefix(rel, url); ok {
+		return strings.Trim(p, "/"), nil
+	}
+	if strings.Contains(rel, "://") {
+		return "", fmt.Errorf("error: %s is not in repository %s", rel, t.repo)
+	}
+	return rel, nil
+}
+
+// exists reports which of the given URLs exist, using a single "svn info"
+// command with the given global options.
+func exists(svnArgs []string, url ...string) (map[string]bool, error) {
+	var stdout, stderr bytes.Buffer
+	arg := append(append(append([]string{}, svnArgs...), "info", "--xml", "--"), url...)
+	// svn reports the URLs that do not exist as warnings, but still reports
+	// the URLs that do exist.
+	err := runSVN("", &stdout, &stderr, arg...)
+	info, perr := parseInfo(stdout.Bytes())
+	if perr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("error: svn info: %w", err)
+		}
+		return nil, perr
+	}
+	found := map[string]bool{}
+	for _, u := range url {
+		found[u] = slices.ContainsFunc(info, func(i svnInfo) bool {
+			return sameURL(i.URL, u)
+		})
+	}
+	return found, nil
+}
+
+// copyPlan is a copy of a path to another path in a single repository.
+type copyPlan struct {
+	target
+	src, dst string // URLs
+	problem  string // reason the copy cannot be made, if any
+}
+
+// planCopies returns a plan to copy path from to path to in each repository in
+// match, after verifying that each source exists and each destination does
+// not.
+func planCopies(match []target, from, to string) ([]*copyPlan, error) {
+	plans := make([]*copyPlan, len(match))
+	bySite := map[*site][]string{}
+	for i, t := range match {
+		vars := t.vars(i, len(match))
+		src, err := repoPath(from, t, vars)
+		if err != nil {
+			return nil, err
+		}
+		dst, err := repoPath(to, t, vars)
+		if err != nil {
+			return nil, err
+		}
+		if dst == "" || dst == src {
+			return nil, fmt.Errorf("error: invalid destination %q in %s", dst, t.repo)
+		}
+		url := t.site.url(t.repo, false)
+		p := &copyPlan{target: t, src: url, dst: url + "/" + dst}
+		if src != "" {
+			p.src += "/" + src
+		}
+		plans[i] = p
+		bySite[t.site] = append(bySite[t.site], p.src, p.dst, parentURL(p.dst))
+	}
+
+	for s, urls := range bySite {
+		found, err := exists(s.svnArgs, urls...)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range plans {
+			switch {
+			case p.site != s:
+			case !found[p.src]:
+				p.problem = "source does not exist: " + p.src
+			case found[p.dst]:
+				p.problem = "destination already exists: " + p.dst
+			case !found[parentURL(p.dst)]:
+				p.problem = "parent of destination does not exist: " + parentURL(p.dst)
+			}
+		}
+	}
+	return plans, nil
+}
+
+// parentURL returns the URL of the parent directory of url.
+func parentURL(url string) string {
+	return url[:strings.LastIndex(url, "/")]
+}
+
+// tag copies path from to path to in each repository in match, e.g., to create
+// the same tag or branch in every repository. The given SVN arguments (e.g., a
+// log message) are added to each copy command.
+//
+// Nothing is copied unless every copy is verified beforehand. If any copy
+// fails, a plan to roll back the copies that succeeded is printed.
+func tag(match []target, from, to string, arg []string, run *runner) error {
+	plans, err := planCopies(match, from, to)
+	if err != nil {
+		return err
+	}
+	var invalid int
+	tw := tabwriter.NewWriter(run.stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "REPOSITORY\tPROBLEM"+newline)
+	for _, p := range plans {
+		if p.problem != "" {
+			invalid++
+			fmt.Fprintf(tw, "%s\t%s"+newline, p.repo, p.problem)
+		}
+	}
+	if invalid > 0 {
+		tw.Flush()
+		return fmt.Errorf("error: validation failed in %d of %d repositories, nothing was copied", invalid, len(plans))
+	}
+
+	// a log message is given by -m or -F, either of which may be attached to
+	// its value (e.g., "-mMSG"), or by --message or --file.
+	hasMessage := slices.ContainsFunc(arg, func(a string) bool {
+		return strings.HasPrefix(a, "-m") || strings.HasPrefix(a, "-F") ||
+			a == "--message" || strings.HasPrefix(a, "--message=") ||
+			a == "--file" || strings.HasPrefix(a, "--file=")
+	})
+	jobs := make([]*job, len(plans))
+	for i, p := range plans {
+		args := append([]string{}, p.site.svnArgs...)
+		args = append(args, "copy")
+		vars := p.vars(i, len(plans))
+		for _, a := range arg {
+			args = append(args, expand(a, p.site.url(p.repo, false), p.repo, "", vars))
+		}
+		if !hasMessage {
+			args = append(args, "-m", fmt.Sprintf("Create %s from %s", path.Base(p.dst), path.Base(p.src)))
+		}
+		args = append(args, "--", p.src, p.dst)
+		jobs[i] = newJob(p.repo, args)
+		jobs[i].profile = p.site.profile
+		jobs[i].url = p.dst
+		jobs[i].webURL = p.site.url(p.repo, true)
+	}
+
+	err = run.run(jobs)
+	if err != nil && !run.dryRun {
+		printRollback(run.stderr, plans, jobs)
+	}
+	return err
+}
+
+// printRollback prints the commands that undo each copy that succeeded, with
+// the same SVN global options as the copy, and lists the copies that failed or
+// were never made.
+func printRollback(w io.Writer, plans []*copyPlan, jobs []*job) {
+	var done, failed []string
+	for i, j := range jobs {
+		switch j.status {
+		case jobSucceeded:
+			args := append(append([]string{}, plans[i].site.svnArgs...), "delete", "-m",
+				"Roll back "+path.Base(plans[i].dst), "--", plans[i].dst)
+			done = append(done, (&job{args: args}).String())
+		default:
+			failed = append(failed, fmt.Sprintf("%s (%s)", plans[i].repo, j.status))
+		}
+	}
+	log.Printf("%d of %d copies were made before the failure\n", len(done), len(jobs))
+	if len(done) > 0 {
+		fmt.Fprint(w, "rollback plan: remove the copies that were made with:"+newline)
+		for _, cmd := range done {
+			fmt.Fprint(w, "  "+cmd+newline)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Fprint(w, "not copied: "+strings.Join(failed, ", ")+newline)
+	}
+}
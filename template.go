@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// argData is the data available to each argument of an SVN command that is
+// expanded as a template (with "-V").
+type argData struct {
+	Profile string // profile of the repository
+	Name    string // repository path relative to the server URL
+	Base    string // last component of Name
+	URL     string // repository URL (or Web URL, with "-w")
+	WebURL  string // Web URL of the repository
+	Server  string // server URL prefix of all repository URLs
+	WC      string // working copy directory (with "-C")
+	Pin     string // revision recorded in snapshot (with "-P")
+	Rev     string // youngest revision of the repository in cache, if known
+	Prev    string // preceding argument, after expansion
+	Index   int    // position of the repository in the list of matches, from 1
+	Count   int    // number of matched repositories
+}
+
+// argFuncs are the functions available to arguments expanded as templates.
+// Functions taking a string operate on their last argument so that they can
+// be used in pipelines, e.g., {{.Name | replace "/" "-" | upper}}.
+var argFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"base":       path.Base,
+	"dir":        path.Dir,
+	"now":        time.Now,
+	"date":       func(layout string, t time.Time) string { return t.Format(layout) },
+}
+
+// parseTemplates parses each of the given arguments as a template.
+func parseTemplates(arg []string) ([]*template.Template, error) {
+	tmpl := make([]*template.Template, len(arg))
+	for i, s := range arg {
+		t, err := template.New(fmt.Sprintf("arg%d", i+1)).Funcs(argFuncs).Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("error: invalid template %q: %w", s, err)
+		}
+		tmpl[i] = t
+	}
+	return tmpl, nil
+}
+
+// execute returns the expansion of template t with data d.
+func (d argData) execute(t *template.Template) (string, error) {
+	var sb strings.Builder
+	if err := t.Execute(&sb, d); err != nil {
+		return "", fmt.Errorf("error: %w", err)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// adminDir is the name of the administrative directory at the root of each
+// SVN working copy.
+const adminDir = ".svn"
+
+// findWorkingCopies returns the root directory of each SVN working copy found
+// in dir or beneath it, in lexical order. Hidden directories and the contents
+// of working copies are not searched.
+func findWorkingCopies(dir string) ([]string, error) {
+	var wcs []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if info, err := os.Stat(filepath.Join(path, adminDir)); err == nil && info.IsDir() {
+			wcs = append(wcs, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error: %w", err)
+	}
+	return wcs, nil
+}
+
+// workingCopies returns a target for each working copy found beneath dir that
+// was checked out from one of the repositories in match.
+//
+// Each working copy is mapped to the repository in the cache of any site whose
+// URL is the root URL of the working copy, or whose UUID is the UUID of the
+// working copy (e.g., if it was checked out using a different server URL).
+func workingCopies(dir string, svnArgs []string, sites []*site, match []target) ([]target, error) {
+	paths, err := findWorkingCopies(dir)
+	if err != nil || len(paths) == 0 {
+		return nil, err
+	}
+	info, err := queryInfo(svnArgs, "", paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := map[target]bool{}
+	for _, t := range match {
+		selected[t] = true
+	}
+	lookup := func(wc svnInfo) (target, bool) {
+		for _, s := range sites {
+			for _, repo := range s.cache.List {
+				uuid := s.cache.Meta[repo].UUID
+				if sameURL(s.url(repo, false), wc.Root) || (uuid != "" && uuid == wc.UUID) {
+					return target{site: s, repo: repo}, true
+				}
+			}
+		}
+		return target{}, false
+	}
+
+	var wcs []target
+	for _, wc := range info {
+		t, ok := lookup(wc)
+		if !ok {
+			log.Printf("warning: skipping working copy %s: repository %s not in cache\n", wc.Path, wc.Root)
+			continue
+		}
+		if selected[t] {
+			t.wc = wc.Path
+			wcs = append(wcs, t)
+		}
+	}
+	return wcs, nil
+}
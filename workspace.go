@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// revision is an SVN revision given in a manifest as either a number or a
+// string, e.g., 1234, "HEAD", or "{2026-05-20}".
+type revision string
+
+func (r *revision) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v == nil {
+		*r = ""
+		return nil
+	}
+	s, err := flagValue(v)
+	if err != nil {
+		return fmt.Errorf("invalid revision: %w", err)
+	}
+	*r = revision(strings.TrimSpace(s))
+	return nil
+}
+
+func (r revision) MarshalJSON() ([]byte, error) {
+	if n, ok := r.number(); ok {
+		return json.Marshal(n)
+	}
+	return json.Marshal(string(r))
+}
+
+// number returns r as a revision number, or false if r is not a number.
+func (r revision) number() (int64, bool) {
+	n, err := strconv.ParseInt(string(r), 10, 64)
+	return n, err == nil
+}
+
+// workspace is a manifest of working copies to check out.
+type workspace struct {
+	Created time.Time  `json:"created,omitzero"` // time a snapshot was recorded
+	Entries []checkout `json:"entries"`
+}
+
+// checkout is a single working copy in a workspace manifest.
+type checkout struct {
+	Profile  string   `json:"profile,omitempty"`  // profile defining Repo
+	Repo     string   `json:"repo"`               // repository in the cache
+	Path     string   `json:"path,omitempty"`     // path within Repo, e.g., "trunk"
+	Dir      string   `json:"dir,omitempty"`      // local directory, base name of Repo by default
+	Revision revision `json:"revision,omitempty"` // operative revision, HEAD by default
+	Peg      revision `json:"peg,omitempty"`      // peg revision of URL
+}
+
+// Actions taken to bring a working copy in line with a workspace manifest.
+const (
+	actionCreate  = "create"  // check out a new working copy
+	actionSwitch  = "switch"  // switch an existing working copy to another URL
+	actionUpdate  = "update"  // update an existing working copy
+	actionCurrent = "current" // nothing, the working copy is already current
+)
+
+// loadWorkspace reads the workspace manifest file. The directory of each entry
+// is resolved relative to the directory containing the manifest.
+func loadWorkspace(file string) (*workspace, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error: %w", err)
+	}
+	var ws workspace
+	if err := json.Unmarshal(data, &ws); err != nil {
+		return nil, fmt.Errorf("error: %s: %w", file, err)
+	}
+	for i := range ws.Entries {
+		e := &ws.Entries[i]
+		e.Repo = strings.Trim(strings.TrimSpace(e.Repo), "/")
+		e.Path = strings.Trim(strings.TrimSpace(e.Path), "/")
+		if e.Repo == "" {
+			return nil, fmt.Errorf("error: %s: entry %d: undefined repository", file, i+1)
+		}
+		if e.Dir == "" {
+			e.Dir = path.Base(e.Repo)
+		}
+		if !filepath.IsAbs(e.Dir) {
+			e.Dir = filepath.Join(filepath.Dir(file), e.Dir)
+		}
+	}
+	return &ws, nil
+}
+
+// target returns the repository of the entry on the site of its profile.
+// Entries without a profile belong to the first of the given sites.
+func (e checkout) target(sites []*site) (target, error) {
+	for _, s := range sites {
+		if s.profile == e.Profile || e.Profile == "" {
+			return target{site: s, repo: e.Repo}, nil
+		}
+	}
+	return target{}, fmt.Errorf("error: %s: undefined profile %q", e.Repo, e.Profile)
+}
+
+// url returns the URL of the entry in repository URL prefix, including its
+// peg revision if any.
+func (e checkout) url(prefix string) string {
+	u := prefix
+	if e.Path != "" {
+		u += "/" + e.Path
+	}
+	if e.Peg != "" {
+		u += "@" + string(e.Peg)
+	}
+	return u
+}
+
+// planCheckout returns the action needed to bring the working copy of the
+// entry in line with the manifest, and the SVN arguments of that action.
+func planCheckout(e checkout, t target) (action string, args []string, err error) {
+	url := e.url(t.site.url(t.repo, false))
+	rev := []string{}
+	if e.Revision != "" {
+		rev = []string{"-r", string(e.Revision)}
+	}
+	svnArgs := []string(t.site.svnArgs)
+	with := func(arg ...string) []string {
+		return append(append([]string{}, svnArgs...), arg...)
+	}
+
+	if _, err := os.Stat(filepath.Join(e.Dir, adminDir)); errors.Is(err, fs.ErrNotExist) {
+		if entries, err := os.ReadDir(e.Dir); err == nil && len(entries) > 0 {
+			return "", nil, fmt.Errorf("error: %s exists and is not a working copy", e.Dir)
+		}
+		return actionCreate, with(append(append([]string{"checkout"}, rev...), "--", url, e.Dir)...), nil
+	}
+
+	wc, err := queryInfo(svnArgs, "", e.Dir)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(wc) == 0 {
+		return "", nil, fmt.Errorf("error: %s: no working copy information", e.Dir)
+	}
+	unpegged := e
+	unpegged.Peg = ""
+	if !sameURL(wc[0].URL, unpegged.url(t.site.url(t.repo, false))) {
+		return actionSwitch, with(append(append([]string{"switch"}, rev...), "--", url, e.Dir)...), nil
+	}
+
+	want, ok := e.Revision.number()
+	if !ok {
+		// resolve symbolic revisions (e.g., HEAD or dates) on the server.
+		head := "HEAD"
+		if e.Revision != "" {
+			head = string(e.Revision)
+		}
+		remote, err := queryInfo(svnArgs, head, url)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(remote) == 0 {
+			return "", nil, fmt.Errorf("error: %s: no repository information", url)
+		}
+		want = remote[0].Revision
+	}
+	if wc[0].Revision == want {
+		return actionCurrent, nil, nil
+	}
+	return actionUpdate, with(append(append([]string{"update"}, rev...), "--", e.Dir)...), nil
+}
+
+// materialize checks out, switches, or updates the working copy of each entry
+// of the workspace manifest whose repository is in match, and reports the
+// action taken for each entry.
+func materialize(ws *workspace, sites []*site, match []target, run *runner) error {
+	selected := map[target]bool{}
+	for _, t := range match {
+		selected[t] = true
+	}
+
+	type result struct {
+		entry  checkout
+		action string
+		job    *job
+	}
+	var results []result
+	var jobs []*job
+	for _, e := range ws.Entries {
+		t, err := e.target(sites)
+		if err != nil {
+			return err
+		}
+		if !selected[t] {
+			if !slices.Contains(t.site.cache.List, e.Repo) {
+				return fmt.Errorf("error: repository %q not in cache %s", e.Repo, t.site.cache.FilePath)
+			}
+			continue
+		}
+		action, args, err := planCheckout(e, t)
+		if err != nil {
+			return err
+		}
+		r := result{entry: e, action: action}
+		if action != actionCurrent {
+			r.job = newJob(t.repo, args)
+			r.job.profile = t.site.profile
+			r.job.url = e.url(t.site.url(t.repo, false))
+			r.job.webURL = t.site.url(t.repo, true)
+			r.job.wc = e.Dir
+			r.job.action = action
+			jobs = append(jobs, r.job)
+		} else if run.format == formatJSON {
+			if err := writeJSON(run.stdout, record{
+				Profile:     t.site.profile,
+				Name:        t.repo,
+				URL:         e.url(t.site.url(t.repo, false)),
+				WebURL:      t.site.url(t.repo, true),
+				WorkingCopy: e.Dir,
+				Action:      action,
+			}); err != nil {
+				return err
+			}
+		}
+		results = append(results, r)
+	}
+
+	err := run.run(jobs)
+	if run.format == formatJSON {
+		return err
+	}
+
+	count := map[string]int{}
+	tw := tabwriter.NewWriter(run.stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "DIRECTORY\tREPOSITORY\tACTION\tSTATUS"+newline)
+	for _, r := range results {
+		status := jobSucceeded
+		if r.job != nil {
+			status = r.job.status
+		}
+		if status == jobSucceeded {
+			count[r.action]++
+		} else {
+			count[status.String()]++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s"+newline,
+			r.entry.Dir, path.Join(r.entry.Repo, r.entry.Path), r.action, status)
+	}
+	tw.Flush()
+	fmt.Fprintf(run.stderr, "%d created, %d switched, %d updated, %d current, %d failed, %d skipped"+newline,
+		count[actionCreate], count[actionSwitch], count[actionUpdate], count[actionCurrent],
+		count[jobFailed.String()], count[jobSkipped.String()])
+	return err
+}